@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"soulbomber-backend/engine"
+)
+
+const aiProfilesFile = "ai_profiles.json"
+
+type AIProfileInfo struct {
+	Name           string  `json:"name"`
+	ReactionDelay  int64   `json:"reactionDelay"`
+	Aggression     float64 `json:"aggression"`
+	Hunting        float64 `json:"hunting"`
+	PowerupGreed   float64 `json:"powerupGreed"`
+	MistakeRate    float64 `json:"mistakeRate"`
+	Vision         int     `json:"vision"`
+	DashChance     float64 `json:"dashChance"`
+	DetonateChance float64 `json:"detonateChance"`
+}
+
+// loadAIProfiles applies the profiles in aiProfilesFile on top of the
+// built-in ones, so difficulties can be retuned and personalities added
+// without a rebuild. A missing file leaves the built-ins as they are.
+func loadAIProfiles() {
+	data, err := os.ReadFile(aiProfilesFile)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logError("Failed to read AI profile file", err, "path", aiProfilesFile)
+		return
+	}
+
+	profiles, err := engine.ParseAIProfiles(data)
+	if err != nil {
+		logError("Invalid AI profile file", err, "path", aiProfilesFile)
+		return
+	}
+	for _, p := range profiles {
+		if err := engine.SetAIProfile(p); err != nil {
+			logError("Invalid AI profile", err, "name", p.Name)
+			continue
+		}
+		logInfo("Loaded AI profile", "name", p.Name)
+	}
+}
+
+func getAIProfileInfo() []AIProfileInfo {
+	var infos []AIProfileInfo
+	for _, p := range engine.AIProfiles() {
+		infos = append(infos, AIProfileInfo{
+			Name:           p.Name,
+			ReactionDelay:  p.ReactionDelay.Milliseconds(),
+			Aggression:     p.Aggression,
+			Hunting:        p.Hunting,
+			PowerupGreed:   p.PowerupGreed,
+			MistakeRate:    p.MistakeRate,
+			Vision:         p.Vision,
+			DashChance:     p.DashChance,
+			DetonateChance: p.DetonateChance,
+		})
+	}
+	return infos
+}
+
+func handleAIProfiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	json.NewEncoder(w).Encode(getAIProfileInfo())
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+// Binary frames start with binaryMagic, which can never begin a JSON text
+// message, followed by an opcode. Integers are varints unless noted and
+// strings are a uvarint length followed by the bytes.
+const (
+	binarySubprotocol = "soulbomber.bin.v2"
+	formatJSON        = "json"
+	formatBinary      = "binary"
+
+	binaryMagic byte = 0xB1
+
+	opGameState      byte = 0x01
+	opMove           byte = 0x10
+	opPlaceBomb      byte = 0x11
+	opDash           byte = 0x12
+	opRemoteDetonate byte = 0x13
+	opAckState       byte = 0x14
+)
+
+var (
+	binaryDirections = []string{"up", "down", "left", "right"}
+	binaryStatuses   = map[string]byte{"playing": 1, "finished": 2}
+	binaryBombTypes  = map[string]byte{engine.BOMB_NORMAL: 1}
+)
+
+func isBinaryFrame(data []byte) bool {
+	return len(data) > 1 && data[0] == binaryMagic
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendPosition(buf []byte, pos engine.Position) []byte {
+	buf = binary.AppendUvarint(buf, uint64(pos.Row))
+	return binary.AppendUvarint(buf, uint64(pos.Col))
+}
+
+func appendRemaining(buf []byte, now, end time.Time) []byte {
+	remaining := end.Sub(now).Milliseconds()
+	if remaining < 0 {
+		remaining = 0
+	}
+	return binary.AppendUvarint(buf, uint64(remaining))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// bombShortID extracts the per-game sequence number from a
+// bomb_<playerId>_<n> ID.
+func bombShortID(id string) uint64 {
+	n, _ := strconv.ParseUint(id[strings.LastIndex(id, "_")+1:], 10, 64)
+	return n
+}
+
+// encodeBinaryGameState lays out a game state as:
+//
+//	magic, opGameState, tick, seed, status(byte), width, height,
+//	width*height tile bytes (row-major),
+//	player count, then per player: id, name, row, col, flags(byte:
+//	  alive|isAI<<1|shield<<2|spectator<<3), score, bombRange, maxBombs,
+//	  team (0 for none), lives,
+//	winner (player index+1, 0 for none or a team win),
+//	winning team (0 for none),
+//	team score count, then per team: team, score,
+//	bomb count, then per bomb: short id, owner index, type(byte), row, col,
+//	  range, fuse remaining ms,
+//	explosion count, then per explosion: row, col, remaining ms,
+//	powerup count, then per powerup: type(byte), level, row, col.
+//
+// Every list is in ID order; bombs refer to their owner by player index.
+func encodeBinaryGameState(g *engine.Game) []byte {
+	now := g.Now()
+
+	buf := []byte{binaryMagic, opGameState}
+	buf = binary.AppendVarint(buf, g.Tick)
+	buf = binary.AppendVarint(buf, g.Seed)
+	buf = append(buf, binaryStatuses[g.Status])
+
+	height := len(g.Board)
+	width := 0
+	if height > 0 {
+		width = len(g.Board[0])
+	}
+	buf = binary.AppendUvarint(buf, uint64(width))
+	buf = binary.AppendUvarint(buf, uint64(height))
+	for _, row := range g.Board {
+		for _, tile := range row {
+			buf = append(buf, byte(tile))
+		}
+	}
+
+	playerIDs := sortedKeys(g.Players)
+	playerIndex := make(map[string]int, len(playerIDs))
+
+	buf = binary.AppendUvarint(buf, uint64(len(playerIDs)))
+	for i, id := range playerIDs {
+		p := g.Players[id]
+		playerIndex[id] = i
+		buf = appendString(buf, p.ID)
+		buf = appendString(buf, p.Name)
+		buf = appendPosition(buf, p.Position)
+		var flags byte
+		if p.Alive {
+			flags |= 1
+		}
+		if p.IsAI {
+			flags |= 1 << 1
+		}
+		if p.Shield {
+			flags |= 1 << 2
+		}
+		if p.Spectator {
+			flags |= 1 << 3
+		}
+		buf = append(buf, flags)
+		buf = binary.AppendVarint(buf, int64(p.Score))
+		buf = binary.AppendUvarint(buf, uint64(p.BombRange))
+		buf = binary.AppendUvarint(buf, uint64(p.MaxBombs))
+		buf = binary.AppendUvarint(buf, uint64(p.Team))
+		buf = binary.AppendUvarint(buf, uint64(p.Lives))
+	}
+
+	winner, winningTeam := uint64(0), uint64(0)
+	if i, ok := playerIndex[g.Winner]; ok {
+		winner = uint64(i + 1)
+	}
+	for team := range g.TeamScores {
+		if g.Winner == engine.TeamWinner(team) {
+			winningTeam = uint64(team)
+		}
+	}
+	buf = binary.AppendUvarint(buf, winner)
+	buf = binary.AppendUvarint(buf, winningTeam)
+
+	teams := make([]int, 0, len(g.TeamScores))
+	for team := range g.TeamScores {
+		teams = append(teams, team)
+	}
+	sort.Ints(teams)
+	buf = binary.AppendUvarint(buf, uint64(len(teams)))
+	for _, team := range teams {
+		buf = binary.AppendUvarint(buf, uint64(team))
+		buf = binary.AppendVarint(buf, int64(g.TeamScores[team]))
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(g.Bombs)))
+	for _, id := range sortedKeys(g.Bombs) {
+		b := g.Bombs[id]
+		buf = binary.AppendUvarint(buf, bombShortID(b.ID))
+		buf = binary.AppendUvarint(buf, uint64(playerIndex[b.PlayerID]))
+		buf = append(buf, binaryBombTypes[b.Type])
+		buf = appendPosition(buf, b.Position)
+		buf = binary.AppendUvarint(buf, uint64(b.Range))
+		buf = appendRemaining(buf, now, b.FuseEnd)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(g.Explosions)))
+	for _, id := range sortedKeys(g.Explosions) {
+		e := g.Explosions[id]
+		buf = appendPosition(buf, e.Position)
+		buf = appendRemaining(buf, now, e.EndTime)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(g.Powerups)))
+	for _, id := range sortedKeys(g.Powerups) {
+		p := g.Powerups[id]
+		buf = append(buf, binaryPowerupCode(p.Type))
+		buf = binary.AppendUvarint(buf, uint64(p.Level))
+		buf = appendPosition(buf, p.Position)
+	}
+
+	return buf
+}
+
+// binaryPowerupCode is the byte a powerup type is sent as, or 0 for a type
+// that isn't registered.
+func binaryPowerupCode(powerupType string) byte {
+	if t, ok := engine.LookupPowerup(powerupType); ok {
+		return t.Code
+	}
+	return 0
+}
+
+// decodeBinaryInput turns a client input frame into the equivalent JSON
+// message so it can go through handleMessage unchanged.
+func decodeBinaryInput(data []byte) (Message, error) {
+	if !isBinaryFrame(data) {
+		return Message{}, errors.New("not a binary frame")
+	}
+
+	op := data[1]
+	rest := data[2:]
+
+	readDirection := func() (string, error) {
+		if len(rest) < 1 || int(rest[0]) >= len(binaryDirections) {
+			return "", errors.New("invalid direction")
+		}
+		return binaryDirections[rest[0]], nil
+	}
+
+	switch op {
+	case opMove, opDash:
+		direction, err := readDirection()
+		if err != nil {
+			return Message{}, err
+		}
+		msgType := "move"
+		if op == opDash {
+			msgType = "dash"
+		}
+		return Message{Type: msgType, Payload: map[string]interface{}{"direction": direction}}, nil
+	case opPlaceBomb:
+		return Message{Type: "placeBomb", Payload: map[string]interface{}{}}, nil
+	case opRemoteDetonate:
+		return Message{Type: "remoteDetonate", Payload: map[string]interface{}{}}, nil
+	case opAckState:
+		tick, n := binary.Varint(rest)
+		if n <= 0 {
+			return Message{}, errors.New("invalid tick")
+		}
+		return Message{Type: "ackState", Payload: map[string]interface{}{"tick": float64(tick)}}, nil
+	}
+	return Message{}, errors.New("unknown binary opcode")
+}
+
+// encodeMessage encodes a message for a connection using format. Only
+// gameState has a binary layout; everything else is JSON in both formats.
+func encodeMessage(format, msgType string, payload interface{}) ([]byte, error) {
+	if state, ok := payload.(*engine.Game); ok && format == formatBinary && msgType == "gameState" {
+		return encodeBinaryGameState(state), nil
+	}
+	return json.Marshal(Message{Type: msgType, Payload: payload})
+}
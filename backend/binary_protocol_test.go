@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+// frameReader walks a binary frame the way a client would.
+type frameReader struct {
+	t   *testing.T
+	buf []byte
+}
+
+func (r *frameReader) byte() byte {
+	r.t.Helper()
+	if len(r.buf) == 0 {
+		r.t.Fatal("frame ended early")
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *frameReader) uvarint() uint64 {
+	r.t.Helper()
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.t.Fatal("bad uvarint")
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *frameReader) varint() int64 {
+	r.t.Helper()
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.t.Fatal("bad varint")
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *frameReader) string() string {
+	r.t.Helper()
+	n := int(r.uvarint())
+	if n > len(r.buf) {
+		r.t.Fatal("string runs past the frame")
+	}
+	s := string(r.buf[:n])
+	r.buf = r.buf[n:]
+	return s
+}
+
+func (r *frameReader) position() engine.Position {
+	r.t.Helper()
+	return engine.Position{Row: int(r.uvarint()), Col: int(r.uvarint())}
+}
+
+// testBinaryState is a small two-team game with a bomb, explosions and
+// powerups, one tick in, that team 2 has already won.
+func testBinaryState(t *testing.T) *engine.Game {
+	t.Helper()
+	g := engine.NewGame("game", "lobby", 5, engine.DefaultGameRules(), nil)
+	spawns := g.SpawnPositions()
+	g.AddPlayer(engine.Player{ID: "b", Name: "Bea", IsAI: true}, spawns[1])
+	g.AddPlayer(engine.Player{ID: "a", Name: "Al"}, spawns[0])
+	g.Step()
+
+	state := g.Snapshot()
+	now := state.Now()
+	state.Players["a"].Shield = true
+	state.Players["a"].Team, state.Players["a"].Lives = 1, 2
+	state.Players["b"].Team, state.Players["b"].Spectator = 2, true
+	state.TeamScores = map[int]int{2: 30, 1: 10}
+	state.Winner = engine.TeamWinner(2)
+	state.Bombs["bomb_b_7"] = &engine.Bomb{
+		ID: "bomb_b_7", Type: engine.BOMB_NORMAL, PlayerID: "b",
+		Position: spawns[1], Range: 2, FuseEnd: now.Add(1500 * time.Millisecond),
+	}
+	for i, col := range []int{3, 1, 2, 5, 4} {
+		id := "explosion_" + string(rune('a'+i))
+		state.Explosions[id] = &engine.Explosion{ID: id, Position: engine.Position{Row: 1, Col: col}, EndTime: now.Add(250 * time.Millisecond)}
+	}
+	state.Powerups["powerup_9"] = &engine.Powerup{ID: "powerup_9", Type: engine.POWERUP_SPEED, Level: 2, Position: engine.Position{Row: 3, Col: 1}}
+	state.Powerups["powerup_10"] = &engine.Powerup{ID: "powerup_10", Type: engine.POWERUP_PIERCE, Level: 1, Position: engine.Position{Row: 1, Col: 3}}
+	return state
+}
+
+func TestEncodeBinaryGameState(t *testing.T) {
+	state := testBinaryState(t)
+	frame := encodeBinaryGameState(state)
+	r := &frameReader{t: t, buf: frame}
+
+	if r.byte() != binaryMagic || r.byte() != opGameState {
+		t.Fatal("bad frame header")
+	}
+	if tick := r.varint(); tick != state.Tick {
+		t.Errorf("tick %d, want %d", tick, state.Tick)
+	}
+	if seed := r.varint(); seed != 5 {
+		t.Errorf("seed %d, want 5", seed)
+	}
+	if status := r.byte(); status != binaryStatuses["playing"] {
+		t.Errorf("status %d", status)
+	}
+	width, height := int(r.uvarint()), int(r.uvarint())
+	if width != len(state.Board[0]) || height != len(state.Board) {
+		t.Fatalf("board %dx%d", width, height)
+	}
+	for row := 0; row < height; row++ {
+		for col := 0; col < width; col++ {
+			if tile := r.byte(); int(tile) != state.Board[row][col] {
+				t.Fatalf("tile (%d,%d) is %d, want %d", row, col, tile, state.Board[row][col])
+			}
+		}
+	}
+
+	if n := r.uvarint(); n != 2 {
+		t.Fatalf("%d players, want 2", n)
+	}
+	players := []struct {
+		id, name string
+		flags    byte
+		team     uint64
+	}{
+		{"a", "Al", 1 | 1<<2, 1},
+		{"b", "Bea", 1 | 1<<1 | 1<<3, 2},
+	}
+	for _, want := range players {
+		p := state.Players[want.id]
+		if id, name := r.string(), r.string(); id != want.id || name != want.name {
+			t.Errorf("player %q %q, want %q %q", id, name, want.id, want.name)
+		}
+		if pos := r.position(); pos != p.Position {
+			t.Errorf("%s at %v, want %v", want.id, pos, p.Position)
+		}
+		if flags := r.byte(); flags != want.flags {
+			t.Errorf("%s flags %b, want %b", want.id, flags, want.flags)
+		}
+		if score, rng, maxBombs := r.varint(), r.uvarint(), r.uvarint(); score != 0 || rng != 1 || maxBombs != 1 {
+			t.Errorf("%s score/range/max %d/%d/%d", want.id, score, rng, maxBombs)
+		}
+		if team, lives := r.uvarint(), r.uvarint(); team != want.team || int(lives) != p.Lives {
+			t.Errorf("%s team %d lives %d, want %d and %d", want.id, team, lives, want.team, p.Lives)
+		}
+	}
+	if winner, team := r.uvarint(), r.uvarint(); winner != 0 || team != 2 {
+		t.Errorf("winner %d team %d, want a win for team 2", winner, team)
+	}
+	if n := r.uvarint(); n != 2 {
+		t.Fatalf("%d team scores, want 2", n)
+	}
+	for _, want := range [][2]int64{{1, 10}, {2, 30}} {
+		if team, score := r.uvarint(), r.varint(); int64(team) != want[0] || score != want[1] {
+			t.Errorf("team %d scored %d, want team %d with %d", team, score, want[0], want[1])
+		}
+	}
+
+	if n := r.uvarint(); n != 1 {
+		t.Fatalf("%d bombs, want 1", n)
+	}
+	if id, owner, typ := r.uvarint(), r.uvarint(), r.byte(); id != 7 || owner != 1 || typ != binaryBombTypes[engine.BOMB_NORMAL] {
+		t.Errorf("bomb id/owner/type %d/%d/%d", id, owner, typ)
+	}
+	if pos, rng, fuse := r.position(), r.uvarint(), r.uvarint(); pos != state.Bombs["bomb_b_7"].Position || rng != 2 || fuse != 1500 {
+		t.Errorf("bomb at %v range %d fuse %dms", pos, rng, fuse)
+	}
+
+	if n := r.uvarint(); n != 5 {
+		t.Fatalf("%d explosions, want 5", n)
+	}
+	for _, col := range []int{3, 1, 2, 5, 4} {
+		if pos, left := r.position(), r.uvarint(); pos.Col != col || left != 250 {
+			t.Errorf("explosion at %v with %dms left, want column %d with 250ms", pos, left, col)
+		}
+	}
+
+	if n := int(r.uvarint()); n != len(state.Powerups) {
+		t.Fatalf("%d powerups, want %d", n, len(state.Powerups))
+	}
+	for _, id := range sortedKeys(state.Powerups) {
+		p := state.Powerups[id]
+		if typ, level, pos := r.byte(), r.uvarint(), r.position(); typ != binaryPowerupCode(p.Type) || int(level) != p.Level || pos != p.Position {
+			t.Errorf("powerup %s: type %d level %d at %v", id, typ, level, pos)
+		}
+	}
+
+	if len(r.buf) != 0 {
+		t.Errorf("%d bytes left over", len(r.buf))
+	}
+}
+
+func TestEncodeBinaryGameStateIsStable(t *testing.T) {
+	state := testBinaryState(t)
+	first := encodeBinaryGameState(state)
+	for i := 0; i < 20; i++ {
+		if !bytes.Equal(encodeBinaryGameState(state), first) {
+			t.Fatal("encoding the same state twice gave different frames")
+		}
+	}
+}
+
+func TestDecodeBinaryInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   []byte
+		want    Message
+		wantErr bool
+	}{
+		{
+			name:  "move",
+			frame: []byte{binaryMagic, opMove, 3},
+			want:  Message{Type: "move", Payload: map[string]interface{}{"direction": "right"}},
+		},
+		{
+			name:  "dash",
+			frame: []byte{binaryMagic, opDash, 0},
+			want:  Message{Type: "dash", Payload: map[string]interface{}{"direction": "up"}},
+		},
+		{
+			name:  "place bomb",
+			frame: []byte{binaryMagic, opPlaceBomb},
+			want:  Message{Type: "placeBomb", Payload: map[string]interface{}{}},
+		},
+		{
+			name:  "remote detonate",
+			frame: []byte{binaryMagic, opRemoteDetonate},
+			want:  Message{Type: "remoteDetonate", Payload: map[string]interface{}{}},
+		},
+		{
+			name:  "ack",
+			frame: binary.AppendVarint([]byte{binaryMagic, opAckState}, 1234),
+			want:  Message{Type: "ackState", Payload: map[string]interface{}{"tick": float64(1234)}},
+		},
+		{name: "bad direction", frame: []byte{binaryMagic, opMove, 4}, wantErr: true},
+		{name: "missing direction", frame: []byte{binaryMagic, opMove}, wantErr: true},
+		{name: "missing tick", frame: []byte{binaryMagic, opAckState}, wantErr: true},
+		{name: "unknown opcode", frame: []byte{binaryMagic, 0x7f}, wantErr: true},
+		{name: "json", frame: []byte(`{"type":"move"}`), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := decodeBinaryInput(tt.frame)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(msg, tt.want) {
+				t.Errorf("got %+v, want %+v", msg, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+// BotIdentity is who a bot connection authenticated as. Every lobby the bot
+// joins gets it a fresh player ID, so one bot can sit in several games.
+type BotIdentity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type BotInfo struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Games     int       `json:"games"`
+	Wins      int       `json:"wins"`
+	AvgScore  float64   `json:"avgScore"`
+	Missed    int       `json:"missed"`
+	Late      int       `json:"late"`
+	Invalid   int       `json:"invalid"`
+	Crashes   int       `json:"crashes"`
+}
+
+// BotObservation is what a bot is sent every tick. Times are in
+// milliseconds from the tick, so bots never have to deal with clocks.
+type BotObservation struct {
+	Tick       int64             `json:"tick"`
+	PlayerID   string            `json:"playerId"`
+	Status     string            `json:"status"`
+	Deadline   int64             `json:"deadline"`
+	Board      [][]int           `json:"board"`
+	Players    []BotPlayer       `json:"players"`
+	Bombs      []BotBomb         `json:"bombs"`
+	Explosions []BotExplosion    `json:"explosions"`
+	Powerups   []*engine.Powerup `json:"powerups"`
+}
+
+type BotPlayer struct {
+	ID           string          `json:"id"`
+	Name         string          `json:"name"`
+	Position     engine.Position `json:"position"`
+	Alive        bool            `json:"alive"`
+	Team         int             `json:"team"`
+	Score        int             `json:"score"`
+	Lives        int             `json:"lives"`
+	MaxBombs     int             `json:"maxBombs"`
+	BombRange    int             `json:"bombRange"`
+	Shield       bool            `json:"shield"`
+	MoveInterval int64           `json:"moveInterval"`
+	DashReady    int64           `json:"dashReady"`
+	Powerups     []string        `json:"powerups"`
+	IsAI         bool            `json:"isAI"`
+	IsBot        bool            `json:"isBot"`
+}
+
+type BotBomb struct {
+	ID       string          `json:"id"`
+	PlayerID string          `json:"playerId"`
+	Position engine.Position `json:"position"`
+	Range    int             `json:"range"`
+	Pierce   bool            `json:"pierce"`
+	Fuse     int64           `json:"fuse"`
+}
+
+type BotExplosion struct {
+	Position  engine.Position `json:"position"`
+	Remaining int64           `json:"remaining"`
+}
+
+// botTally counts a bot player's decisions that went wrong in one game.
+type botTally struct {
+	Missed  int
+	Late    int
+	Invalid int
+	Crashed bool
+}
+
+// botMessages are the only messages an authenticated bot may send.
+var botMessages = map[string]bool{
+	"botAuth":            true,
+	"joinLobby":          true,
+	"leaveLobby":         true,
+	"startGame":          true,
+	"action":             true,
+	"requestLobbyUpdate": true,
+	"ping":               true,
+}
+
+var (
+	botTallies   = make(map[string]map[string]*botTally)
+	botTalliesMu sync.Mutex
+)
+
+func hashBotToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createBot registers a bot and returns its token. Only a hash of the token
+// is stored, so it can't be shown again.
+func createBot(name string) (*BotIdentity, string, error) {
+	bot := &BotIdentity{ID: newUUID(), Name: name}
+	token := newToken()
+	_, err := db.Exec(`
+		INSERT INTO bots (id, name, token_hash, created_at)
+		VALUES (?, ?, ?, ?)
+	`, bot.ID, bot.Name, hashBotToken(token), time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+	return bot, token, nil
+}
+
+func lookupBotToken(token string) (*BotIdentity, error) {
+	var bot BotIdentity
+	err := db.QueryRow(`SELECT id, name FROM bots WHERE token_hash = ?`, hashBotToken(token)).Scan(&bot.ID, &bot.Name)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("invalid bot token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bot, nil
+}
+
+const botInfoQuery = `
+	SELECT b.id, b.name, b.created_at,
+		COUNT(r.game_id), COALESCE(SUM(r.won), 0), COALESCE(AVG(r.score), 0),
+		COALESCE(SUM(r.missed), 0), COALESCE(SUM(r.late), 0), COALESCE(SUM(r.invalid), 0), COALESCE(SUM(r.crashed), 0)
+	FROM bots b
+	LEFT JOIN bot_results r ON r.bot_id = b.id
+`
+
+func scanBotInfo(row interface{ Scan(...interface{}) error }) (BotInfo, error) {
+	var info BotInfo
+	err := row.Scan(
+		&info.ID,
+		&info.Name,
+		&info.CreatedAt,
+		&info.Games,
+		&info.Wins,
+		&info.AvgScore,
+		&info.Missed,
+		&info.Late,
+		&info.Invalid,
+		&info.Crashes,
+	)
+	return info, err
+}
+
+func getBots() []BotInfo {
+	rows, err := db.Query(botInfoQuery + ` GROUP BY b.id ORDER BY b.name`)
+	if err != nil {
+		logError("Error querying bots", err)
+		return []BotInfo{}
+	}
+	defer rows.Close()
+
+	bots := []BotInfo{}
+	for rows.Next() {
+		info, err := scanBotInfo(rows)
+		if err != nil {
+			logError("Error scanning bot", err)
+			continue
+		}
+		bots = append(bots, info)
+	}
+	return bots
+}
+
+func getBot(id string) (*BotInfo, error) {
+	info, err := scanBotInfo(db.QueryRow(botInfoQuery+` WHERE b.id = ? GROUP BY b.id`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("bot not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func tallyBot(gameID, playerID string, count func(t *botTally)) {
+	botTalliesMu.Lock()
+	defer botTalliesMu.Unlock()
+	tallies, ok := botTallies[gameID]
+	if !ok {
+		tallies = make(map[string]*botTally)
+		botTallies[gameID] = tallies
+	}
+	t, ok := tallies[playerID]
+	if !ok {
+		t = &botTally{}
+		tallies[playerID] = t
+	}
+	count(t)
+}
+
+func dropBotTallies(gameID string) map[string]*botTally {
+	botTalliesMu.Lock()
+	defer botTalliesMu.Unlock()
+	tallies := botTallies[gameID]
+	delete(botTallies, gameID)
+	return tallies
+}
+
+// recordBotResults stores how every bot in a finished game did, apart from
+// the humans' results.
+func recordBotResults(result *engine.Game) {
+	tallies := dropBotTallies(result.ID)
+	now := time.Now()
+	for _, p := range result.Players {
+		if p.BotID == "" {
+			continue
+		}
+		won := result.Winner == p.ID || (p.Team > 0 && result.Winner == engine.TeamWinner(p.Team))
+		t := tallies[p.ID]
+		if t == nil {
+			t = &botTally{}
+		}
+		_, err := db.Exec(`
+			INSERT OR REPLACE INTO bot_results (bot_id, game_id, player_id, score, won, survived, missed, late, invalid, crashed, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, p.BotID, result.ID, p.ID, p.Score, won, p.Alive, t.Missed, t.Late, t.Invalid, t.Crashed, now)
+		if err != nil {
+			logError("Failed to record bot result", err, "botID", p.BotID, "gameID", result.ID)
+		}
+	}
+}
+
+func newBotObservation(state *engine.Game) BotObservation {
+	now := state.Now()
+	ms := func(t time.Time) int64 {
+		return max(0, t.Sub(now).Milliseconds())
+	}
+
+	obs := BotObservation{
+		Tick:       state.Tick,
+		Status:     state.Status,
+		Board:      state.Board,
+		Players:    []BotPlayer{},
+		Bombs:      []BotBomb{},
+		Explosions: []BotExplosion{},
+		Powerups:   []*engine.Powerup{},
+	}
+	for _, id := range sortedKeys(state.Players) {
+		p := state.Players[id]
+		view := BotPlayer{
+			ID:           p.ID,
+			Name:         p.Name,
+			Position:     p.Position,
+			Alive:        p.Alive,
+			Team:         p.Team,
+			Score:        p.Score,
+			Lives:        p.Lives,
+			MaxBombs:     p.MaxBombs,
+			BombRange:    p.BombRange,
+			Shield:       p.Shield,
+			MoveInterval: state.MoveInterval(p).Milliseconds(),
+			DashReady:    ms(p.LastDash.Add(state.Rules.DashCooldown)),
+			Powerups:     sortedKeys(p.Powerups),
+			IsAI:         p.IsAI,
+			IsBot:        p.BotID != "",
+		}
+		obs.Players = append(obs.Players, view)
+	}
+	for _, id := range sortedKeys(state.Bombs) {
+		b := state.Bombs[id]
+		obs.Bombs = append(obs.Bombs, BotBomb{
+			ID:       b.ID,
+			PlayerID: b.PlayerID,
+			Position: b.Position,
+			Range:    b.Range,
+			Pierce:   b.Pierce,
+			Fuse:     ms(b.FuseEnd),
+		})
+	}
+	for _, id := range sortedKeys(state.Explosions) {
+		e := state.Explosions[id]
+		obs.Explosions = append(obs.Explosions, BotExplosion{Position: e.Position, Remaining: ms(e.EndTime)})
+	}
+	for _, id := range sortedKeys(state.Powerups) {
+		obs.Powerups = append(obs.Powerups, state.Powerups[id])
+	}
+	return obs
+}
+
+// sendObservations sends each bot connection its own copy of obs. A bot
+// that is alive in a running game is expected to answer within the rules'
+// decision time. A bot still within the time for an earlier observation
+// isn't sent a new one until it answers; one that ran out of time has that
+// answer counted as missed.
+func sendObservations(conns []*Connection, state *engine.Game) {
+	obs := newBotObservation(state)
+	deadline := state.Rules.BotDecisionTime()
+	sent := time.Now()
+
+	for _, conn := range conns {
+		player, inGame := state.Players[conn.PlayerID]
+		decide := state.Status == "playing" && inGame && player.Alive
+
+		conn.mu.Lock()
+		owed := conn.botPending && conn.botGame == state.ID
+		if owed && decide && !sent.After(conn.botDeadline) {
+			conn.mu.Unlock()
+			continue
+		}
+		conn.botGame = state.ID
+		conn.botTick = state.Tick
+		conn.botDeadline = sent.Add(deadline)
+		conn.botPending = decide
+		conn.mu.Unlock()
+
+		if owed {
+			tallyBot(state.ID, conn.PlayerID, func(t *botTally) { t.Missed++ })
+		}
+
+		view := obs
+		view.PlayerID = conn.PlayerID
+		if decide {
+			view.Deadline = deadline.Milliseconds()
+		}
+		hub.sendToConnection(conn, "observation", view)
+	}
+}
+
+func (c *Connection) bot() *BotIdentity {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Bot
+}
+
+func (c *Connection) handleBotAuth(payload interface{}) error {
+	data, ok := payload.(map[string]interface{})
+	if !ok {
+		return c.sendError("Invalid payload format")
+	}
+
+	token, ok := data["token"].(string)
+	if !ok || token == "" {
+		return c.sendError("Missing token")
+	}
+	if c.PlayerID != "" || c.Spectator {
+		return c.sendError("Authenticate before joining a lobby")
+	}
+
+	bot, err := lookupBotToken(token)
+	if err != nil {
+		logError("Bot authentication failed", err, "connectionID", c.ID)
+		return c.sendError("Invalid bot token")
+	}
+
+	c.mu.Lock()
+	c.Bot = bot
+	c.mu.Unlock()
+
+	logInfo("Bot authenticated", "connectionID", c.ID, "botID", bot.ID, "name", bot.Name)
+	return c.sendMessage("botAuthenticated", bot)
+}
+
+// handleBotAction takes a bot's answer to the latest observation. Answers
+// to older ticks, second answers and answers past the deadline are turned
+// down and the player idles for that tick.
+func (c *Connection) handleBotAction(payload interface{}) error {
+	if c.bot() == nil {
+		return c.sendError("Only bots can send actions")
+	}
+
+	data, ok := payload.(map[string]interface{})
+	if !ok {
+		return c.sendError("Invalid payload format")
+	}
+	tickValue, ok := data["tick"].(float64)
+	if !ok {
+		return c.sendError("Missing tick")
+	}
+	tick := int64(tickValue)
+	action, _ := data["type"].(string)
+
+	game := getGameByPlayerID(c.PlayerID)
+	if game == nil {
+		return c.sendError("Game not found")
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	reason := ""
+	switch {
+	case tick != c.botTick:
+		reason = "stale"
+	case !c.botPending:
+		reason = "unexpected"
+	case now.After(c.botDeadline):
+		reason = "late"
+	}
+	if reason == "" || reason == "late" {
+		c.botPending = false
+	}
+	gameID := c.botGame
+	c.mu.Unlock()
+
+	if reason == "" {
+		input, err := botInput(c.PlayerID, action, data)
+		if err == nil {
+			if input != nil {
+				game.Enqueue(*input)
+			}
+			return nil
+		}
+		reason = err.Error()
+		tallyBot(gameID, c.PlayerID, func(t *botTally) { t.Invalid++ })
+	} else if reason == "late" {
+		tallyBot(gameID, c.PlayerID, func(t *botTally) { t.Late++ })
+	}
+
+	return c.sendMessage("actionRejected", map[string]interface{}{
+		"tick":   tick,
+		"reason": reason,
+	})
+}
+
+// botInput turns an action message into a game input. "idle" is a valid
+// answer that does nothing.
+func botInput(playerID, action string, data map[string]interface{}) (*engine.Input, error) {
+	direction, _ := data["direction"].(string)
+	switch action {
+	case "idle":
+		return nil, nil
+	case "move", "dash":
+		if err := ValidateDirection(direction); err != nil {
+			return nil, err
+		}
+		inputType := engine.INPUT_MOVE
+		if action == "dash" {
+			inputType = engine.INPUT_DASH
+		}
+		return &engine.Input{Type: inputType, PlayerID: playerID, Direction: direction}, nil
+	case "placeBomb":
+		return &engine.Input{Type: engine.INPUT_PLACE_BOMB, PlayerID: playerID}, nil
+	case "remoteDetonate":
+		return &engine.Input{Type: engine.INPUT_REMOTE_DETONATE, PlayerID: playerID}, nil
+	}
+	return nil, errors.New("invalid action: " + action)
+}
+
+func handleBots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/bots"), "/")
+
+	switch r.Method {
+	case "GET":
+		if id == "" {
+			json.NewEncoder(w).Encode(getBots())
+			return
+		}
+		if err := ValidateBotID(id); err != nil {
+			http.Error(w, "Invalid bot ID", http.StatusBadRequest)
+			return
+		}
+		info, err := getBot(id)
+		if err != nil {
+			http.Error(w, "Bot not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+
+	case "POST":
+		if id != "" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireAdmin(w, r) {
+			return
+		}
+		var request struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logError("Error decoding bot request", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := ValidatePlayerName(request.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		bot, token, err := createBot(SanitizeString(request.Name))
+		if err != nil {
+			logError("Error creating bot", err, "name", request.Name)
+			http.Error(w, "Failed to create bot", http.StatusInternalServerError)
+			return
+		}
+		logInfo("Bot registered", "botID", bot.ID, "name", bot.Name)
+		json.NewEncoder(w).Encode(map[string]string{
+			"id":    bot.ID,
+			"name":  bot.Name,
+			"token": token,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+func TestSendObservations(t *testing.T) {
+	tests := []struct {
+		name        string
+		pending     bool
+		deadlineIn  time.Duration // from now, for the observation already sent
+		dead        bool
+		wantSent    bool
+		wantMissed  int
+		wantPending bool
+	}{
+		{name: "answered bot gets the next tick", wantSent: true, wantPending: true},
+		{name: "bot inside its deadline is left to answer", pending: true, deadlineIn: time.Second, wantPending: true},
+		{name: "bot past its deadline misses", pending: true, deadlineIn: -time.Millisecond, wantSent: true, wantMissed: 1, wantPending: true},
+		{name: "dead bot owes nothing", dead: true, wantSent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := testLobbyConn(t, "lobby")
+			conn.PlayerID = "bot"
+			hub.connections[conn.ID] = conn
+
+			g := engine.NewGame("game-"+tt.name, "lobby", 1, engine.DefaultGameRules(), nil)
+			g.AddPlayer(engine.Player{ID: "bot", Name: "Bot"}, g.SpawnPositions()[0])
+			g.Step()
+			state := g.Snapshot()
+			state.Players["bot"].Alive = !tt.dead
+			t.Cleanup(func() {
+				botTalliesMu.Lock()
+				delete(botTallies, state.ID)
+				botTalliesMu.Unlock()
+			})
+
+			conn.botGame = state.ID
+			conn.botPending = tt.pending
+			conn.botDeadline = time.Now().Add(tt.deadlineIn)
+
+			sendObservations([]*Connection{conn}, state)
+
+			got := nextMessageType(t, conn)
+			if tt.wantSent && got != "observation" {
+				t.Errorf("sent %s, want an observation", got)
+			}
+			if !tt.wantSent && got != "nothing" {
+				t.Errorf("sent %s, want nothing", got)
+			}
+			missed := 0
+			botTalliesMu.Lock()
+			if tally := botTallies[state.ID]["bot"]; tally != nil {
+				missed = tally.Missed
+			}
+			botTalliesMu.Unlock()
+			if missed != tt.wantMissed {
+				t.Errorf("%d missed, want %d", missed, tt.wantMissed)
+			}
+			if conn.botPending != tt.wantPending {
+				t.Errorf("pending %v, want %v", conn.botPending, tt.wantPending)
+			}
+		})
+	}
+}
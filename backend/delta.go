@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+const (
+	keyframeInterval = 100
+	deltaAckWindow   = 40
+)
+
+type TileChange struct {
+	Row   int `json:"row"`
+	Col   int `json:"col"`
+	Value int `json:"value"`
+}
+
+// GameDelta is what changed between the states at BaseTick and Tick. Maps
+// hold added or changed entries; the Removed lists hold IDs that are gone.
+type GameDelta struct {
+	Tick              int64                        `json:"tick"`
+	BaseTick          int64                        `json:"baseTick"`
+	Status            string                       `json:"status,omitempty"`
+	Winner            string                       `json:"winner,omitempty"`
+	TeamScores        map[int]int                  `json:"teamScores,omitempty"`
+	EndTime           *time.Time                   `json:"endTime,omitempty"`
+	Tiles             []TileChange                 `json:"tiles,omitempty"`
+	Players           map[string]*engine.Player    `json:"players,omitempty"`
+	RemovedPlayers    []string                     `json:"removedPlayers,omitempty"`
+	Bombs             map[string]*engine.Bomb      `json:"bombs,omitempty"`
+	RemovedBombs      []string                     `json:"removedBombs,omitempty"`
+	Explosions        map[string]*engine.Explosion `json:"explosions,omitempty"`
+	RemovedExplosions []string                     `json:"removedExplosions,omitempty"`
+	Powerups          map[string]*engine.Powerup   `json:"powerups,omitempty"`
+	RemovedPowerups   []string                     `json:"removedPowerups,omitempty"`
+}
+
+func diffEntities[V any](prev, cur map[string]*V) (map[string]*V, []string) {
+	var changed map[string]*V
+	var removed []string
+	for id, v := range cur {
+		if old, ok := prev[id]; ok && reflect.DeepEqual(old, v) {
+			continue
+		}
+		if changed == nil {
+			changed = make(map[string]*V)
+		}
+		changed[id] = v
+	}
+	for id := range prev {
+		if _, ok := cur[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	return changed, removed
+}
+
+func diffGameState(prev, cur *engine.Game) *GameDelta {
+	delta := &GameDelta{
+		Tick:     cur.Tick,
+		BaseTick: prev.Tick,
+	}
+
+	if cur.Status != prev.Status {
+		delta.Status = cur.Status
+	}
+	if cur.Winner != prev.Winner {
+		delta.Winner = cur.Winner
+	}
+	if !reflect.DeepEqual(cur.TeamScores, prev.TeamScores) {
+		delta.TeamScores = cur.TeamScores
+	}
+	if !cur.EndTime.Equal(prev.EndTime) {
+		end := cur.EndTime
+		delta.EndTime = &end
+	}
+
+	for row := range cur.Board {
+		for col := range cur.Board[row] {
+			if row < len(prev.Board) && col < len(prev.Board[row]) && prev.Board[row][col] == cur.Board[row][col] {
+				continue
+			}
+			delta.Tiles = append(delta.Tiles, TileChange{Row: row, Col: col, Value: cur.Board[row][col]})
+		}
+	}
+
+	delta.Players, delta.RemovedPlayers = diffEntities(prev.Players, cur.Players)
+	delta.Bombs, delta.RemovedBombs = diffEntities(prev.Bombs, cur.Bombs)
+	delta.Explosions, delta.RemovedExplosions = diffEntities(prev.Explosions, cur.Explosions)
+	delta.Powerups, delta.RemovedPowerups = diffEntities(prev.Powerups, cur.Powerups)
+
+	return delta
+}
+
+// stateStream remembers the states recently broadcast to a lobby, so the
+// next one can be sent to each connection as a delta against the newest
+// state it is known to have.
+type stateStream struct {
+	recent map[int64]*engine.Game
+}
+
+var (
+	stateStreams   = make(map[string]*stateStream)
+	stateStreamsMu sync.Mutex
+)
+
+func dropStateStream(lobbyID string) {
+	stateStreamsMu.Lock()
+	delete(stateStreams, lobbyID)
+	stateStreamsMu.Unlock()
+}
+
+// deltaBase picks the tick c should be sent tick as a delta against: the
+// later of the last state it acknowledged and the last keyframe it was
+// sent. It reports false when c needs a keyframe instead. It must be called
+// with c.mu held.
+func (c *Connection) deltaBase(tick int64) (int64, bool) {
+	if !c.WantsDelta || c.lastStateTick < 0 || tick%keyframeInterval == 0 {
+		return 0, false
+	}
+	base := max(c.ackTick, c.keyframeTick)
+	if base >= tick || tick-base > deltaAckWindow {
+		return 0, false
+	}
+	return base, true
+}
+
+// publishGameState broadcasts state to a lobby, sending each JSON
+// connection either a delta against the newest state it is known to have
+// or a full keyframe. Binary connections always get a compact keyframe and
+// bots an observation. Each payload is encoded at most once.
+func publishGameState(lobbyID string, state *engine.Game) {
+	stateStreamsMu.Lock()
+	stream, ok := stateStreams[lobbyID]
+	if !ok {
+		stream = &stateStream{recent: make(map[int64]*engine.Game)}
+		stateStreams[lobbyID] = stream
+	}
+	stream.recent[state.Tick] = state
+	recent := make(map[int64]*engine.Game, len(stream.recent))
+	for tick, s := range stream.recent {
+		if state.Tick-tick > deltaAckWindow {
+			delete(stream.recent, tick)
+			continue
+		}
+		recent[tick] = s
+	}
+	stateStreamsMu.Unlock()
+
+	var (
+		encodeMu                 sync.Mutex
+		keyframe, binaryKeyframe []byte
+		deltas                   = make(map[int64][]byte)
+	)
+	encodeKeyframe := func() []byte {
+		encodeMu.Lock()
+		defer encodeMu.Unlock()
+		if keyframe == nil {
+			data, err := json.Marshal(Message{Type: "gameState", Payload: state})
+			if err != nil {
+				logError("Failed to marshal game state", err)
+			}
+			keyframe = data
+		}
+		return keyframe
+	}
+	encodeDelta := func(base int64) []byte {
+		encodeMu.Lock()
+		defer encodeMu.Unlock()
+		if _, ok := deltas[base]; !ok {
+			data, err := json.Marshal(Message{Type: "gameDelta", Payload: diffGameState(recent[base], state)})
+			if err != nil {
+				logError("Failed to marshal game delta", err)
+			}
+			deltas[base] = data
+		}
+		return deltas[base]
+	}
+	encodeBinaryKeyframe := func() []byte {
+		encodeMu.Lock()
+		defer encodeMu.Unlock()
+		if binaryKeyframe == nil {
+			binaryKeyframe = encodeBinaryGameState(state)
+		}
+		return binaryKeyframe
+	}
+
+	deliver := func(conn *Connection) {
+		conn.mu.Lock()
+		base, ok := conn.deltaBase(state.Tick)
+		conn.mu.Unlock()
+		full := !ok || recent[base] == nil
+
+		var data []byte
+		switch {
+		case conn.Format == formatBinary:
+			data = encodeBinaryKeyframe()
+			full = true
+		case full:
+			data = encodeKeyframe()
+		default:
+			data = encodeDelta(base)
+		}
+		if data == nil {
+			return
+		}
+
+		sent := false
+		select {
+		case conn.Send <- data:
+			sent = true
+		default:
+		}
+
+		conn.mu.Lock()
+		if sent {
+			conn.lastStateTick = state.Tick
+			if full {
+				conn.keyframeTick = state.Tick
+				conn.ackTick = -1
+			}
+		} else {
+			conn.lastStateTick = -1
+		}
+		conn.mu.Unlock()
+	}
+
+	hub.mu.RLock()
+	var delayed, bots []*Connection
+	for _, conn := range hub.lobbyConnections[lobbyID] {
+		if conn.bot() != nil {
+			bots = append(bots, conn)
+			continue
+		}
+		if conn.delay() > 0 {
+			delayed = append(delayed, conn)
+			continue
+		}
+		deliver(conn)
+	}
+	hub.mu.RUnlock()
+
+	if len(bots) > 0 {
+		sendObservations(bots, state)
+	}
+
+	if len(delayed) > 0 {
+		deliverDelayed(lobbyID, delayed, deliver)
+	}
+}
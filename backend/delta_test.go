@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"soulbomber-backend/engine"
+)
+
+// testLobbyConn attaches a connection with a roomy send buffer to lobbyID on
+// a fresh hub.
+func testLobbyConn(t *testing.T, lobbyID string) *Connection {
+	t.Helper()
+	hub = NewHub()
+	conn := &Connection{ID: "conn", LobbyID: lobbyID, Send: make(chan []byte, 256)}
+	hub.lobbyConnections[lobbyID] = map[string]*Connection{conn.ID: conn}
+	t.Cleanup(func() { dropStateStream(lobbyID) })
+	return conn
+}
+
+// describeFrame reads the next frame sent to conn as "state" or
+// "delta@<base tick>".
+func describeFrame(t *testing.T, conn *Connection) string {
+	t.Helper()
+	select {
+	case data := <-conn.Send:
+		var msg struct {
+			Type    string    `json:"type"`
+			Payload GameDelta `json:"payload"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "gameDelta" {
+			return fmt.Sprintf("delta@%d", msg.Payload.BaseTick)
+		}
+		return "state"
+	default:
+		return "nothing"
+	}
+}
+
+func TestPublishGameStateDeltaBase(t *testing.T) {
+	tests := []struct {
+		name       string
+		wantsDelta bool
+		ticks      int64
+		acks       map[int64]int64 // tick received -> tick acknowledged
+		want       map[int64]string
+	}{
+		{
+			name:  "deltas not requested",
+			ticks: 3,
+			want:  map[int64]string{1: "state", 2: "state", 3: "state"},
+		},
+		{
+			name:       "unacked deltas stay on the keyframe",
+			wantsDelta: true,
+			ticks:      3,
+			want:       map[int64]string{1: "state", 2: "delta@1", 3: "delta@1"},
+		},
+		{
+			name:       "acks move the base forward",
+			wantsDelta: true,
+			ticks:      4,
+			acks:       map[int64]int64{2: 2, 3: 3},
+			want:       map[int64]string{2: "delta@1", 3: "delta@2", 4: "delta@3"},
+		},
+		{
+			name:       "acks for unsent ticks are ignored",
+			wantsDelta: true,
+			ticks:      3,
+			acks:       map[int64]int64{2: 50},
+			want:       map[int64]string{3: "delta@1"},
+		},
+		{
+			name:       "keyframe once the base falls out of the window",
+			wantsDelta: true,
+			ticks:      deltaAckWindow + 2,
+			want:       map[int64]string{deltaAckWindow + 1: "delta@1", deltaAckWindow + 2: "state"},
+		},
+		{
+			name:       "keyframe interval",
+			wantsDelta: true,
+			ticks:      keyframeInterval + 1,
+			acks:       map[int64]int64{keyframeInterval - 1: keyframeInterval - 1},
+			want:       map[int64]string{keyframeInterval: "state", keyframeInterval + 1: fmt.Sprintf("delta@%d", keyframeInterval)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := testLobbyConn(t, "lobby-"+tt.name)
+			conn.WantsDelta = tt.wantsDelta
+			g := engine.NewGame("game", conn.LobbyID, 1, engine.DefaultGameRules(), nil)
+
+			for tick := int64(1); tick <= tt.ticks; tick++ {
+				g.Step()
+				publishGameState(conn.LobbyID, g.Snapshot())
+				got := describeFrame(t, conn)
+				if want, ok := tt.want[tick]; ok && got != want {
+					t.Errorf("tick %d: got %s, want %s", tick, got, want)
+				}
+				if ack, ok := tt.acks[tick]; ok {
+					if err := conn.handleAckState(map[string]interface{}{"tick": float64(ack)}); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
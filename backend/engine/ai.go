@@ -0,0 +1,474 @@
+package engine
+
+import "time"
+
+const (
+	// aiSearchDepth bounds how many steps ahead the AI plans.
+	aiSearchDepth = 24
+	// aiProbeBombID names the bomb the AI imagines dropping when checking
+	// it could get away from it.
+	aiProbeBombID = "ai-probe"
+)
+
+var aiDirections = []string{"up", "down", "left", "right"}
+
+func (g *Game) scheduleAIMove(playerID string) {
+	player, exists := g.Players[playerID]
+	if !exists || !player.IsAI {
+		return
+	}
+	g.nextAIMove[playerID] = g.now().Add(aiProfile(player).ReactionDelay)
+}
+
+func (g *Game) runAI(now time.Time) {
+	for _, playerID := range sortedKeys(g.nextAIMove) {
+		if now.Before(g.nextAIMove[playerID]) {
+			continue
+		}
+		if g.makeAIMove(playerID) {
+			g.nextAIMove[playerID] = g.nextMoveAt(g.Players[playerID], now)
+		} else {
+			g.scheduleAIMove(playerID)
+		}
+	}
+}
+
+// nextMoveAt is the first tick after now at which player may move again.
+func (g *Game) nextMoveAt(player *Player, now time.Time) time.Time {
+	next := player.LastMove.Add(g.MoveInterval(player))
+	if next.After(now) {
+		return next
+	}
+	return now.Add(g.Rules.TickInterval())
+}
+
+// aiStep is how long the AI takes per cell when it is in a hurry: the
+// player's move interval, plus a tick for the decision to land.
+func (g *Game) aiStep(player *Player) time.Duration {
+	return g.MoveInterval(player) + g.Rules.TickInterval()
+}
+
+// makeAIMove decides and applies one AI action. It returns true while the
+// AI is in or passing through a blast's path, so it gets to act again as
+// soon as it can move.
+func (g *Game) makeAIMove(playerID string) bool {
+	player, exists := g.Players[playerID]
+	if !exists || !player.Alive {
+		return false
+	}
+
+	profile := aiProfile(player)
+	now := g.now()
+	step := g.aiStep(player)
+	danger := g.dangerMap(now, nil, "")
+
+	if len(danger[player.Position]) > 0 {
+		if g.aiRng.Float64() < profile.DashChance && g.aiDash(player, danger, now) {
+			return true
+		}
+		if dir, ok := g.aiSearch(player, danger, now, step, aiSearchDepth, danger.safe); ok && dir != "" {
+			g.aiMove(player, dir)
+		}
+		return true
+	}
+
+	if g.aiRng.Float64() < profile.MistakeRate {
+		return g.wander(player, danger)
+	}
+
+	if g.aiRng.Float64() < profile.DetonateChance && g.detonateWorthwhile(player, now) {
+		return g.accept(Input{Type: INPUT_REMOTE_DETONATE, PlayerID: playerID}, true) == nil
+	}
+
+	canBomb := g.aiCanBomb(player)
+	if canBomb && g.aiRng.Float64() < profile.Aggression {
+		blocks, opponents := g.blastValue(player, player.Position, danger)
+		if (blocks > 0 || opponents > 0) && g.canEscapeBomb(player, now, step) {
+			return g.accept(Input{Type: INPUT_PLACE_BOMB, PlayerID: playerID}, true) == nil
+		}
+	}
+
+	collect := func(pos Position) bool { return g.collectableAt(player, pos) }
+	farm := func(pos Position) bool {
+		blocks, _ := g.blastValue(player, pos, danger)
+		return blocks > 0
+	}
+	hunt := func(pos Position) bool {
+		_, opponents := g.blastValue(player, pos, danger)
+		return opponents > 0
+	}
+
+	var goals []func(Position) bool
+	greedy := g.aiRng.Float64() < profile.PowerupGreed
+	if greedy {
+		goals = append(goals, collect)
+	}
+	if canBomb {
+		if g.aiRng.Float64() < profile.Hunting {
+			goals = append(goals, hunt, farm)
+		} else {
+			goals = append(goals, farm, hunt)
+		}
+	}
+	if !greedy {
+		goals = append(goals, collect)
+	}
+
+	for _, goal := range goals {
+		if dir, ok := g.aiSearch(player, danger, now, step, profile.Vision, goal); ok {
+			if dir == "" {
+				return false
+			}
+			return g.aiMove(player, dir) && len(danger[player.Position]) > 0
+		}
+	}
+
+	return g.wander(player, danger)
+}
+
+// aiMove moves the player and reports whether it took.
+func (g *Game) aiMove(player *Player, dir string) bool {
+	return g.accept(Input{Type: INPUT_MOVE, PlayerID: player.ID, Direction: dir}, true) == nil
+}
+
+// wander takes a random step onto a cell no blast will reach, so the AI can
+// idle there safely until its next decision.
+func (g *Game) wander(player *Player, danger dangerMap) bool {
+	var moves []string
+	for _, dir := range aiDirections {
+		if g.isValidMove(player.ID, dir) && danger.safe(g.getNewPosition(player.Position, dir)) {
+			moves = append(moves, dir)
+		}
+	}
+	if len(moves) > 0 {
+		g.aiMove(player, moves[g.aiRng.Intn(len(moves))])
+	}
+	return false
+}
+
+// aiDash dashes to a cell no blast will reach, if the dash is off cooldown
+// and some direction lands on one.
+func (g *Game) aiDash(player *Player, danger dangerMap, now time.Time) bool {
+	if now.Sub(player.LastDash) < g.Rules.DashCooldown {
+		return false
+	}
+	for _, dir := range g.shuffledDirections() {
+		landing := player.Position
+		for next := g.getNewPosition(landing, dir); g.walkable(next); next = g.getNewPosition(next, dir) {
+			landing = next
+		}
+		if landing != player.Position && danger.safe(landing) {
+			return g.accept(Input{Type: INPUT_DASH, PlayerID: player.ID, Direction: dir}, true) == nil
+		}
+	}
+	return false
+}
+
+// detonateWorthwhile reports whether setting off the player's bombs right
+// now would catch an opponent while leaving the player, and any teammate
+// the blast would hurt, untouched.
+func (g *Game) detonateWorthwhile(player *Player, now time.Time) bool {
+	owns := false
+	for _, bomb := range g.Bombs {
+		if bomb.PlayerID == player.ID {
+			owns = true
+			break
+		}
+	}
+	if !owns {
+		return false
+	}
+
+	danger := g.dangerMap(now, nil, player.ID)
+	burning := func(pos Position) bool {
+		return !danger.clear(pos, now, now.Add(g.Rules.TickInterval()))
+	}
+	if burning(player.Position) {
+		return false
+	}
+	hits := false
+	for _, other := range g.Players {
+		if other.ID == player.ID || !other.Alive || other.Spectator || !burning(other.Position) {
+			continue
+		}
+		if g.sameTeam(player.ID, other.ID) {
+			if g.Rules.FriendlyFire {
+				return false
+			}
+			continue
+		}
+		hits = true
+	}
+	return hits
+}
+
+type dangerWindow struct {
+	from time.Time
+	to   time.Time
+}
+
+// dangerMap lists, for every cell that a known bomb or explosion will
+// reach, when it is deadly.
+type dangerMap map[Position][]dangerWindow
+
+// clear reports whether standing on pos from from until to is survivable.
+func (d dangerMap) clear(pos Position, from, to time.Time) bool {
+	for _, w := range d[pos] {
+		if from.Before(w.to) && w.from.Before(to) {
+			return false
+		}
+	}
+	return true
+}
+
+// safe reports whether no known blast ever reaches pos.
+func (d dangerMap) safe(pos Position) bool {
+	return len(d[pos]) == 0
+}
+
+// dangerMap works out when every bomb on the board, plus extra if given,
+// will go off, with the bombs of the player named by detonatedBy going off
+// now. A bomb caught in another's blast goes off with it, so bombs are
+// settled earliest first and pass their time on down the chain.
+func (g *Game) dangerMap(now time.Time, extra *Bomb, detonatedBy string) dangerMap {
+	bombs := make(map[string]*Bomb, len(g.Bombs)+1)
+	detonate := make(map[string]time.Time, len(g.Bombs)+1)
+	for id, bomb := range g.Bombs {
+		bombs[id] = bomb
+		detonate[id] = bomb.FuseEnd
+		if detonatedBy != "" && bomb.PlayerID == detonatedBy {
+			detonate[id] = now
+		}
+	}
+	if extra != nil {
+		bombs[extra.ID] = extra
+		detonate[extra.ID] = extra.FuseEnd
+	}
+	for _, id := range g.detonations {
+		if _, ok := bombs[id]; ok {
+			detonate[id] = now
+		}
+	}
+
+	danger := make(dangerMap)
+	settled := make(map[string]bool, len(bombs))
+	for len(settled) < len(bombs) {
+		next, chosen := "", false
+		for _, id := range sortedKeys(bombs) {
+			if !settled[id] && (!chosen || detonate[id].Before(detonate[next])) {
+				next, chosen = id, true
+			}
+		}
+		settled[next] = true
+
+		at := detonate[next]
+		if at.Before(now) {
+			at = now
+		}
+		window := dangerWindow{from: at, to: at.Add(g.Rules.ExplosionLifetime)}
+		for _, pos := range g.blastCells(bombs[next]) {
+			danger[pos] = append(danger[pos], window)
+			for _, id := range sortedKeys(bombs) {
+				if !settled[id] && bombs[id].Position == pos && at.Before(detonate[id]) {
+					detonate[id] = at
+				}
+			}
+		}
+	}
+
+	for _, explosion := range g.Explosions {
+		danger[explosion.Position] = append(danger[explosion.Position], dangerWindow{from: now, to: explosion.EndTime})
+	}
+	return danger
+}
+
+// blastCells is the cross a bomb will burn, following the same rules as
+// explodeBombInternal: walls stop it, and soft blocks stop it after being
+// destroyed unless the bomb pierces.
+func (g *Game) blastCells(bomb *Bomb) []Position {
+	cells := []Position{bomb.Position}
+	for _, dir := range aiDirections {
+		pos := bomb.Position
+		for i := 1; i <= bomb.Range; i++ {
+			pos = g.getNewPosition(pos, dir)
+			if !g.isValidPosition(pos) || g.Board[pos.Row][pos.Col] == 1 {
+				break
+			}
+			cells = append(cells, pos)
+			if g.Board[pos.Row][pos.Col] == 2 && !bomb.Pierce {
+				break
+			}
+		}
+	}
+	return cells
+}
+
+// aiSearch walks breadth first from the player's cell, only through cells
+// that are clear for as long as the player could be standing on them, and
+// returns the first step towards the nearest cell goal accepts. An empty
+// direction means the player is already there.
+func (g *Game) aiSearch(player *Player, danger dangerMap, now time.Time, step time.Duration, depthLimit int, goal func(Position) bool) (string, bool) {
+	if goal(player.Position) {
+		return "", true
+	}
+
+	type node struct {
+		pos   Position
+		first string
+	}
+	seen := map[Position]bool{player.Position: true}
+	frontier := []node{{pos: player.Position}}
+
+	directions := g.shuffledDirections()
+	for depth := 1; depth <= depthLimit && len(frontier) > 0; depth++ {
+		// The first step may land now or a full step late, depending on
+		// when the player last moved, so allow for either.
+		arrive := now.Add(time.Duration(depth-1) * step)
+		var next []node
+		for _, n := range frontier {
+			for _, dir := range directions {
+				pos := g.getNewPosition(n.pos, dir)
+				if seen[pos] || !g.walkable(pos) || !danger.clear(pos, arrive, arrive.Add(2*step)) {
+					continue
+				}
+				seen[pos] = true
+				first := n.first
+				if first == "" {
+					first = dir
+				}
+				if goal(pos) {
+					return first, true
+				}
+				next = append(next, node{pos: pos, first: first})
+			}
+		}
+		frontier = next
+	}
+	return "", false
+}
+
+func (g *Game) shuffledDirections() []string {
+	directions := make([]string, len(aiDirections))
+	copy(directions, aiDirections)
+	g.aiRng.Shuffle(len(directions), func(i, j int) {
+		directions[i], directions[j] = directions[j], directions[i]
+	})
+	return directions
+}
+
+func (g *Game) walkable(pos Position) bool {
+	if !g.isValidPosition(pos) || g.Board[pos.Row][pos.Col] != 0 {
+		return false
+	}
+	return g.bombAt(pos) == nil
+}
+
+func (g *Game) aiCanBomb(player *Player) bool {
+	if g.bombAt(player.Position) != nil {
+		return false
+	}
+	count := 0
+	for _, bomb := range g.Bombs {
+		if bomb.PlayerID == player.ID {
+			count++
+		}
+	}
+	return count < player.MaxBombs
+}
+
+// blastValue counts what a bomb the player dropped at pos would catch: soft
+// blocks nothing else is about to destroy, and opponents. Both are zero if
+// the bomb can't go there or would catch a teammate the blast would hurt.
+func (g *Game) blastValue(player *Player, pos Position, danger dangerMap) (blocks, opponents int) {
+	if g.bombAt(pos) != nil {
+		return 0, 0
+	}
+	bomb := &Bomb{Position: pos, Range: player.BombRange}
+	_, bomb.Pierce = player.Powerups[POWERUP_PIERCE]
+
+	for _, cell := range g.blastCells(bomb) {
+		if g.Board[cell.Row][cell.Col] == 2 && danger.safe(cell) {
+			blocks++
+		}
+		for _, other := range g.Players {
+			if other.ID == player.ID || !other.Alive || other.Spectator || other.Position != cell {
+				continue
+			}
+			if g.sameTeam(player.ID, other.ID) {
+				if g.Rules.FriendlyFire {
+					return 0, 0
+				}
+				continue
+			}
+			opponents++
+		}
+	}
+	return blocks, opponents
+}
+
+// canEscapeBomb reports whether the player could drop a bomb where they
+// stand and still reach a cell no blast will touch, the new bomb and any
+// chain it sets off included.
+func (g *Game) canEscapeBomb(player *Player, now time.Time, step time.Duration) bool {
+	danger := g.dangerMap(now, g.probeBomb(player, now), "")
+	_, ok := g.aiSearch(player, danger, now, step, aiSearchDepth, func(pos Position) bool {
+		return pos != player.Position && danger.safe(pos)
+	})
+	return ok
+}
+
+// probeBomb is the bomb player would drop if they placed one now.
+func (g *Game) probeBomb(player *Player, now time.Time) *Bomb {
+	bomb := &Bomb{
+		ID:       aiProbeBombID,
+		Type:     BOMB_NORMAL,
+		PlayerID: player.ID,
+		Position: player.Position,
+		Range:    player.BombRange,
+		FuseEnd:  now.Add(g.Rules.fuseDuration(BOMB_NORMAL)),
+	}
+	_, bomb.Pierce = player.Powerups[POWERUP_PIERCE]
+	return bomb
+}
+
+// collectableAt reports whether there is a powerup at pos the player would
+// actually pick up.
+func (g *Game) collectableAt(player *Player, pos Position) bool {
+	for _, powerup := range g.Powerups {
+		if powerup.Position != pos {
+			continue
+		}
+		t, ok := powerupRegistry[powerup.Type]
+		if !ok {
+			continue
+		}
+		if t.Combines {
+			return true
+		}
+		blocked := false
+		for heldType := range player.Powerups {
+			if other, ok := powerupRegistry[heldType]; ok && heldType != t.Name && !other.Combines {
+				blocked = true
+			}
+		}
+		if !blocked {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Game) getNewPosition(pos Position, direction string) Position {
+	newPos := pos
+	switch direction {
+	case "up":
+		newPos.Row--
+	case "down":
+		newPos.Row++
+	case "left":
+		newPos.Col--
+	case "right":
+		newPos.Col++
+	}
+	return newPos
+}
@@ -0,0 +1,155 @@
+package engine
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AIProfile tunes how an AI player behaves. The difficulties and the
+// personalities are all profiles; a player's AIDifficulty names one.
+type AIProfile struct {
+	Name string `json:"name"`
+	// ReactionDelay is how long the AI waits between decisions while it
+	// isn't dodging a blast.
+	ReactionDelay time.Duration `json:"reactionDelay"`
+	// Aggression is the chance of dropping a bomb when one would be worth
+	// it and there is a way out.
+	Aggression float64 `json:"aggression"`
+	// Hunting is the chance of going after opponents before soft blocks
+	// when both are in sight.
+	Hunting float64 `json:"hunting"`
+	// PowerupGreed is the chance of heading for a powerup before anything
+	// else.
+	PowerupGreed float64 `json:"powerupGreed"`
+	// MistakeRate is the chance of wandering instead of following a plan.
+	MistakeRate float64 `json:"mistakeRate"`
+	// Vision is how many steps away the AI looks for targets.
+	Vision int `json:"vision"`
+	// DashChance is the chance of dashing out of a blast's path rather
+	// than walking.
+	DashChance float64 `json:"dashChance"`
+	// DetonateChance is the chance of setting its bombs off early when
+	// that would catch an opponent.
+	DetonateChance float64 `json:"detonateChance"`
+}
+
+const maxAIReactionDelay = 5 * time.Second
+
+var aiProfiles = make(map[string]*AIProfile)
+
+// builtinAIProfiles holds the difficulties and personalities every server
+// starts with.
+//
+//go:embed ai_profiles.json
+var builtinAIProfiles []byte
+
+func init() {
+	profiles, err := ParseAIProfiles(builtinAIProfiles)
+	if err != nil {
+		panic(err)
+	}
+	for _, p := range profiles {
+		if err := SetAIProfile(p); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (p *AIProfile) Validate() error {
+	if p.Name == "" || len(p.Name) > 32 {
+		return fmt.Errorf("AI profile name must be 1 to 32 characters")
+	}
+	if err := validateDuration("reaction delay", p.ReactionDelay, 0, maxAIReactionDelay); err != nil {
+		return fmt.Errorf("AI profile %s: %v", p.Name, err)
+	}
+	for name, v := range map[string]float64{
+		"aggression":      p.Aggression,
+		"hunting":         p.Hunting,
+		"powerup greed":   p.PowerupGreed,
+		"mistake rate":    p.MistakeRate,
+		"dash chance":     p.DashChance,
+		"detonate chance": p.DetonateChance,
+	} {
+		if v < 0 || v > 1 {
+			return fmt.Errorf("AI profile %s: %s must be between 0 and 1", p.Name, name)
+		}
+	}
+	if p.Vision < 1 || p.Vision > aiSearchDepth {
+		return fmt.Errorf("AI profile %s: vision must be between 1 and %d", p.Name, aiSearchDepth)
+	}
+	return nil
+}
+
+// SetAIProfile adds p, replacing any profile of the same name. Profiles are
+// read by running games without locking, so this must only be called
+// before any game starts.
+func SetAIProfile(p AIProfile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	aiProfiles[p.Name] = &p
+	return nil
+}
+
+func LookupAIProfile(name string) (*AIProfile, bool) {
+	p, ok := aiProfiles[name]
+	return p, ok
+}
+
+// AIProfiles lists the known profiles in name order.
+func AIProfiles() []*AIProfile {
+	profiles := make([]*AIProfile, 0, len(aiProfiles))
+	for _, name := range sortedKeys(aiProfiles) {
+		profiles = append(profiles, aiProfiles[name])
+	}
+	return profiles
+}
+
+// ParseAIProfiles reads a profile file: a JSON array of profiles, with the
+// reaction delay written as a duration string such as "600ms". Fields left
+// out are taken from the medium profile once it is loaded.
+func ParseAIProfiles(data []byte) ([]AIProfile, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid AI profile file: %v", err)
+	}
+
+	profiles := make([]AIProfile, 0, len(raw))
+	for _, r := range raw {
+		var p AIProfile
+		if medium, ok := aiProfiles[AI_MEDIUM]; ok {
+			p = *medium
+			p.Name = ""
+		}
+		entry := struct {
+			*AIProfile
+			ReactionDelay string `json:"reactionDelay"`
+		}{AIProfile: &p}
+		if err := json.Unmarshal(r, &entry); err != nil {
+			return nil, fmt.Errorf("invalid AI profile: %v", err)
+		}
+		if entry.ReactionDelay != "" {
+			d, err := time.ParseDuration(entry.ReactionDelay)
+			if err != nil {
+				return nil, fmt.Errorf("AI profile %s: invalid reaction delay: %v", p.Name, err)
+			}
+			p.ReactionDelay = d
+		}
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// aiProfile is the profile an AI player runs on, falling back to medium
+// for names that aren't loaded.
+func aiProfile(player *Player) *AIProfile {
+	if p, ok := aiProfiles[player.AIDifficulty]; ok {
+		return p
+	}
+	return aiProfiles[AI_MEDIUM]
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDangerMapProbeSetsOffLongerFuse(t *testing.T) {
+	g := newTestGame(t, 1)
+	now := g.now()
+	g.Bombs["bomb_1"] = &Bomb{
+		ID:       "bomb_1",
+		Type:     BOMB_NORMAL,
+		Position: Position{Row: 1, Col: 3},
+		Range:    2,
+		FuseEnd:  now.Add(8 * time.Second),
+	}
+	player := &Player{ID: "p1", Position: Position{Row: 1, Col: 1}, BombRange: 2}
+	probe := g.probeBomb(player, now)
+
+	danger := g.dangerMap(now, probe, "")
+
+	// (3,3) is only in bomb_1's blast, so it burns when the probe sets
+	// bomb_1 off rather than when bomb_1's own fuse runs out.
+	windows := danger[Position{Row: 3, Col: 3}]
+	if len(windows) != 1 {
+		t.Fatalf("got %d danger windows at (3,3), want 1", len(windows))
+	}
+	if want := probe.FuseEnd; !windows[0].from.Equal(want) {
+		t.Errorf("(3,3) burns at %s, want %s", windows[0].from.Sub(now), want.Sub(now))
+	}
+}
+
+func TestBuiltinAIProfiles(t *testing.T) {
+	for _, name := range []string{AI_EASY, AI_MEDIUM, AI_HARD, AI_CHOSEN_ONE, AI_CAMPER, AI_HUNTER, AI_FARMER} {
+		if _, ok := LookupAIProfile(name); !ok {
+			t.Errorf("no built-in %s profile", name)
+		}
+	}
+
+	profiles, err := ParseAIProfiles([]byte(`[{"name": "cautious", "reactionDelay": "2s"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	medium, _ := LookupAIProfile(AI_MEDIUM)
+	want := *medium
+	want.Name = "cautious"
+	want.ReactionDelay = 2 * time.Second
+	if len(profiles) != 1 || profiles[0] != want {
+		t.Errorf("parsed %+v, want %+v", profiles, want)
+	}
+}
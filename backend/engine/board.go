@@ -0,0 +1,211 @@
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+const (
+	MinBoardSize = 11
+	MaxBoardSize = 31
+
+	SPAWN_CORNERS = "corners"
+	SPAWN_EDGES   = "edges"
+	SPAWN_MIXED   = "mixed"
+)
+
+type BoardConfig struct {
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	SoftDensity float64 `json:"softDensity"`
+	SpawnLayout string  `json:"spawnLayout"`
+}
+
+func DefaultBoardConfig() BoardConfig {
+	return BoardConfig{
+		Width:       15,
+		Height:      15,
+		SoftDensity: 0.6,
+		SpawnLayout: SPAWN_CORNERS,
+	}
+}
+
+func validateBoardDimension(name string, size int) error {
+	if size < MinBoardSize || size > MaxBoardSize || size%2 == 0 {
+		return fmt.Errorf("board %s must be an odd number between %d and %d", name, MinBoardSize, MaxBoardSize)
+	}
+	return nil
+}
+
+func (c BoardConfig) Validate() error {
+	if err := validateBoardDimension("width", c.Width); err != nil {
+		return err
+	}
+	if err := validateBoardDimension("height", c.Height); err != nil {
+		return err
+	}
+	if c.SoftDensity < 0 || c.SoftDensity > 1 {
+		return fmt.Errorf("soft block density must be between 0 and 1")
+	}
+	switch c.SpawnLayout {
+	case SPAWN_CORNERS, SPAWN_EDGES, SPAWN_MIXED:
+	default:
+		return fmt.Errorf("invalid spawn layout: %s", c.SpawnLayout)
+	}
+	return nil
+}
+
+// SpawnPositions lists the spawn cells for c in the order players are
+// assigned to them. All of them sit on odd rows and columns, so they are
+// never pillars.
+func SpawnPositions(c BoardConfig) []Position {
+	top, left := 1, 1
+	bottom, right := c.Height-2, c.Width-2
+	midRow, midCol := oddCentre(c.Height), oddCentre(c.Width)
+
+	corners := []Position{
+		{Row: top, Col: left},
+		{Row: top, Col: right},
+		{Row: bottom, Col: left},
+		{Row: bottom, Col: right},
+	}
+	edges := []Position{
+		{Row: top, Col: midCol},
+		{Row: midRow, Col: right},
+		{Row: bottom, Col: midCol},
+		{Row: midRow, Col: left},
+	}
+
+	switch c.SpawnLayout {
+	case SPAWN_EDGES:
+		return edges
+	case SPAWN_MIXED:
+		return append(corners, edges...)
+	default:
+		return corners
+	}
+}
+
+// oddCentre is the middle index of size cells, nudged onto an odd index so
+// it is never a pillar row or column.
+func oddCentre(size int) int {
+	centre := size / 2
+	if centre%2 == 0 {
+		centre--
+	}
+	return centre
+}
+
+func isPillar(row, col int) bool {
+	return row%2 == 0 && col%2 == 0
+}
+
+// newBoard lays out the map chosen in rules, or generates a random board
+// when there is none.
+func newBoard(rng *rand.Rand, rules GameRules) [][]int {
+	if rules.Map != nil {
+		return rules.Map.Board()
+	}
+	return GenerateBoard(rng, rules.Board)
+}
+
+func GenerateBoard(rng *rand.Rand, c BoardConfig) [][]int {
+	board := make([][]int, c.Height)
+	for i := range board {
+		board[i] = make([]int, c.Width)
+	}
+
+	for i := 0; i < c.Height; i++ {
+		for j := 0; j < c.Width; j++ {
+			if i == 0 || i == c.Height-1 || j == 0 || j == c.Width-1 {
+				board[i][j] = 1
+			} else if isPillar(i, j) {
+				board[i][j] = 1
+			} else if rng.Float64() < c.SoftDensity {
+				board[i][j] = 2
+			}
+		}
+	}
+
+	for _, spawn := range SpawnPositions(c) {
+		clearAround(board, spawn)
+	}
+
+	return board
+}
+
+// clearAround empties the soft blocks on and next to pos so a player
+// spawning there has room to place a bomb and step away from it.
+func clearAround(board [][]int, pos Position) {
+	cells := []Position{
+		pos,
+		{Row: pos.Row - 1, Col: pos.Col},
+		{Row: pos.Row + 1, Col: pos.Col},
+		{Row: pos.Row, Col: pos.Col - 1},
+		{Row: pos.Row, Col: pos.Col + 1},
+	}
+	for _, cell := range cells {
+		if cell.Row < 0 || cell.Row >= len(board) || cell.Col < 0 || cell.Col >= len(board[cell.Row]) {
+			continue
+		}
+		if board[cell.Row][cell.Col] == 2 {
+			board[cell.Row][cell.Col] = 0
+		}
+	}
+}
+
+func (g *Game) generatePowerups(level int) map[string]*Powerup {
+	powerups := make(map[string]*Powerup)
+
+	if g.Rules.Map != nil && len(g.Rules.Map.Powerups) > 0 {
+		for _, p := range g.Rules.Map.Powerups {
+			if !g.powerupEnabled(p.Type) {
+				continue
+			}
+			powerup := g.newPowerup(p.Type, level, p.Position)
+			powerups[powerup.ID] = powerup
+		}
+		return powerups
+	}
+
+	height := len(g.Board)
+	width := len(g.Board[0])
+	centerRow := oddCentre(height)
+	centerCol := oddCentre(width)
+	radius := max(2, min(height, width)/5)
+
+	if g.Board[centerRow][centerCol] != 1 && g.powerupEnabled(POWERUP_SHIELD) {
+		shield := g.newPowerup(POWERUP_SHIELD, 1, Position{Row: centerRow, Col: centerCol})
+		powerups[shield.ID] = shield
+	}
+
+	var validPositions []Position
+	for i := 1; i < height-1; i++ {
+		for j := 1; j < width-1; j++ {
+			if isPillar(i, j) || g.Board[i][j] == 1 {
+				continue
+			}
+			if i == centerRow && j == centerCol {
+				continue
+			}
+			if ((i == centerRow-radius || i == centerRow+radius) && (j >= centerCol-radius && j <= centerCol+radius)) ||
+				((j == centerCol-radius || j == centerCol+radius) && (i >= centerRow-radius && i <= centerRow+radius)) {
+				validPositions = append(validPositions, Position{Row: i, Col: j})
+			}
+		}
+	}
+
+	for len(powerups) < 3 && len(validPositions) > 0 {
+		idx := g.rng.Intn(len(validPositions))
+		randomPos := validPositions[idx]
+		validPositions = append(validPositions[:idx], validPositions[idx+1:]...)
+		powerupType := g.randomPowerupType()
+		if powerupType == "" {
+			break
+		}
+		powerup := g.newPowerup(powerupType, level, randomPos)
+		powerups[powerup.ID] = powerup
+	}
+
+	return powerups
+}
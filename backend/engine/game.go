@@ -0,0 +1,1134 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	aiSeedOffset     = 0x5eed
+	baseMoveInterval = 150 * time.Millisecond
+)
+
+// FinishedLinger is how long a finished round stays up, with the result on
+// screen, before the game ends.
+const FinishedLinger = 5 * time.Second
+
+var errMoveTooSoon = errors.New("moving too fast")
+
+// Host is implemented by whatever runs the game. The engine never touches
+// the network or the database itself; everything that leaves the simulation
+// goes through these callbacks, which are always invoked without the game
+// lock held.
+type Host interface {
+	Broadcast(g *Game, msgType string, payload interface{})
+	SendToPlayer(g *Game, playerID string, msgType string, payload interface{})
+	GameFinished(g *Game, result *Game)
+	GameEnded(g *Game)
+}
+
+type nopHost struct{}
+
+func (nopHost) Broadcast(*Game, string, interface{})            {}
+func (nopHost) SendToPlayer(*Game, string, string, interface{}) {}
+func (nopHost) GameFinished(*Game, *Game)                       {}
+func (nopHost) GameEnded(*Game)                                 {}
+
+// NewGame builds a game whose board, powerups and AI decisions are all drawn
+// from RNGs seeded with seed, so the same seed and the same inputs always
+// play out the same way. The AI gets its own stream so that replaying
+// recorded AI inputs leaves the world RNG untouched.
+func NewGame(id, lobbyID string, seed int64, rules GameRules, host Host) *Game {
+	if host == nil {
+		host = nopHost{}
+	}
+	rng := rand.New(rand.NewSource(seed))
+	g := &Game{
+		ID:         id,
+		LobbyID:    lobbyID,
+		Board:      newBoard(rng, rules),
+		Players:    make(map[string]*Player),
+		Bombs:      make(map[string]*Bomb),
+		Explosions: make(map[string]*Explosion),
+		Status:     "playing",
+		StartTime:  time.Now(),
+		Seed:       seed,
+		Rules:      rules,
+		host:       host,
+		rng:        rng,
+		aiRng:      rand.New(rand.NewSource(seed + aiSeedOffset)),
+		nextAIMove: make(map[string]time.Time),
+		stats:      make(map[string]*PlayerStats),
+	}
+	g.Powerups = g.generatePowerups(1)
+	return g
+}
+
+// AddPlayer places p on its spawn with fresh round stats. It must be called
+// before Start.
+func (g *Game) AddPlayer(p Player, spawn Position) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p.Alive = true
+	p.BombCount = 0
+	p.MaxBombs = 1
+	p.BombRange = 1
+	p.MoveInterval = baseMoveInterval
+	p.LastMove = time.Time{}
+	p.Score = 0
+	p.Lives = 0
+	if g.Rules.elimination() {
+		p.Lives = g.Rules.Lives
+	}
+	p.Spectator = false
+	if !g.Rules.TeamMode() {
+		p.Team = 0
+	}
+	p.Powerups = make(map[string]*PlayerPowerup)
+	p.Position = spawn
+	p.SpawnPosition = spawn
+	g.Players[p.ID] = &p
+	g.roster = append(g.roster, ReplayPlayer{
+		ID:           p.ID,
+		Name:         p.Name,
+		IsAI:         p.IsAI,
+		AIDifficulty: p.AIDifficulty,
+		Team:         p.Team,
+		Spawn:        spawn,
+	})
+	if p.IsAI && g.replay == nil {
+		g.scheduleAIMove(p.ID)
+	}
+}
+
+func (g *Game) SpawnPositions() []Position {
+	if g.Rules.Map != nil {
+		return g.Rules.Map.SpawnPositions()
+	}
+	return SpawnPositions(g.Rules.Board)
+}
+
+// TeamSpawnPositions splits the spawn points into one group per team.
+// Spawns are swept clockwise around the centre of the board and cut into
+// consecutive runs, so teammates start next to each other.
+func (g *Game) TeamSpawnPositions() [][]Position {
+	spawns := g.SpawnPositions()
+	teams := g.Rules.Teams
+	if teams <= 0 {
+		return [][]Position{spawns}
+	}
+
+	centreRow := float64(len(g.Board)-1) / 2
+	centreCol := float64(len(g.Board[0])-1) / 2
+	sorted := make([]Position, len(spawns))
+	copy(sorted, spawns)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ai := math.Atan2(float64(sorted[i].Row)-centreRow, float64(sorted[i].Col)-centreCol)
+		aj := math.Atan2(float64(sorted[j].Row)-centreRow, float64(sorted[j].Col)-centreCol)
+		return ai < aj
+	})
+
+	groups := make([][]Position, teams)
+	for i, pos := range sorted {
+		team := i * teams / len(sorted)
+		groups[team] = append(groups[team], pos)
+	}
+	return groups
+}
+
+func (g *Game) HasPlayer(playerID string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	_, exists := g.Players[playerID]
+	return exists
+}
+
+func (g *Game) nextID(prefix string) string {
+	g.seq++
+	return fmt.Sprintf("%s_%d", prefix, g.seq)
+}
+
+func (g *Game) Snapshot() *Game {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.snapshotLocked()
+}
+
+func (g *Game) snapshotLocked() *Game {
+	boardCopy := make([][]int, len(g.Board))
+	for i := range g.Board {
+		boardCopy[i] = make([]int, len(g.Board[i]))
+		copy(boardCopy[i], g.Board[i])
+	}
+
+	playersCopy := make(map[string]*Player)
+	for id, player := range g.Players {
+		pc := *player
+		playersCopy[id] = &pc
+	}
+
+	bombsCopy := make(map[string]*Bomb)
+	for id, bomb := range g.Bombs {
+		bc := *bomb
+		bombsCopy[id] = &bc
+	}
+
+	explosionsCopy := make(map[string]*Explosion)
+	for id, ex := range g.Explosions {
+		ec := *ex
+		explosionsCopy[id] = &ec
+	}
+
+	gameCopy := &Game{
+		ID:         g.ID,
+		LobbyID:    g.LobbyID,
+		Board:      boardCopy,
+		Players:    playersCopy,
+		Bombs:      bombsCopy,
+		Explosions: explosionsCopy,
+		Powerups:   copyPowerups(g.Powerups),
+		Status:     g.Status,
+		StartTime:  g.StartTime,
+		EndTime:    g.EndTime,
+		Winner:     g.Winner,
+		TeamScores: g.teamScores(),
+		Tick:       g.Tick,
+		Seed:       g.Seed,
+		Rules:      g.Rules,
+	}
+
+	return gameCopy
+}
+
+func copyPowerups(powerups map[string]*Powerup) map[string]*Powerup {
+	powerupsCopy := make(map[string]*Powerup)
+	for id, pu := range powerups {
+		puc := *pu
+		powerupsCopy[id] = &puc
+	}
+	return powerupsCopy
+}
+
+// now is the simulation clock: game time only advances with ticks, so
+// everything scheduled against it behaves the same regardless of wall-clock
+// jitter in the loop.
+func (g *Game) now() time.Time {
+	return g.StartTime.Add(time.Duration(g.Tick) * g.Rules.TickInterval())
+}
+
+// Now is the game clock at the current tick. It is also valid on snapshots.
+func (g *Game) Now() time.Time {
+	return g.now()
+}
+
+func (g *Game) Enqueue(input Input) {
+	g.inputMu.Lock()
+	g.inputs = append(g.inputs, input)
+	g.inputMu.Unlock()
+}
+
+func (g *Game) drainInputs() []Input {
+	g.inputMu.Lock()
+	defer g.inputMu.Unlock()
+	inputs := g.inputs
+	g.inputs = nil
+	return inputs
+}
+
+// Start runs the tick loop in the background until Stop is called or the
+// round has finished and lingered.
+func (g *Game) Start() {
+	g.stop = make(chan struct{})
+	go g.run()
+}
+
+func (g *Game) run() {
+	ticker := time.NewTicker(g.Rules.TickInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+			g.Step()
+		}
+	}
+}
+
+func (g *Game) Stop() {
+	g.stopOnce.Do(func() {
+		if g.stop != nil {
+			close(g.stop)
+		}
+	})
+}
+
+// Step advances the game by exactly one tick and emits a single state
+// broadcast. All mutation of a running game happens here.
+func (g *Game) Step() {
+	g.mu.Lock()
+
+	if g.Status == "finished" {
+		done := !g.now().Before(g.EndTime.Add(FinishedLinger))
+		g.Tick++
+		g.mu.Unlock()
+		if done {
+			g.end()
+		}
+		return
+	}
+
+	g.Tick++
+	now := g.now()
+
+	var failed []inputError
+	if g.replay != nil {
+		g.applyRecorded()
+	} else {
+		var early []Input
+		for _, input := range g.drainInputs() {
+			if input.Type == INPUT_MOVE && !g.moveReady(input.PlayerID, now) {
+				early = append(early, input)
+				continue
+			}
+			if err := g.accept(input, false); err != nil {
+				failed = append(failed, inputError{PlayerID: input.PlayerID, Err: err})
+			}
+		}
+		g.requeueEarlyMoves(early)
+		g.runAI(now)
+	}
+	g.slideBombs()
+	g.queueDueFuses(now)
+	g.resolveDetonations()
+	g.advanceSuddenDeath(now)
+	g.checkWinCondition(now)
+	g.expireExplosions(now)
+	g.expirePowerups(now)
+
+	if !g.powerupWave && !now.Before(g.StartTime.Add(g.Rules.PowerupWaveDelay)) {
+		g.powerupWave = true
+		wave := g.generatePowerups(2)
+		g.events = append(g.events, Event{Type: "powerupSpawn", Payload: copyPowerups(wave)})
+		for id, powerup := range g.Powerups {
+			if powerup.Dropped {
+				wave[id] = powerup
+			}
+		}
+		g.Powerups = wave
+	}
+
+	if g.Status != "finished" && g.roundOver(now) {
+		g.finishRound(now)
+	}
+	finished := g.Status == "finished"
+
+	events := g.events
+	g.events = nil
+	state := g.snapshotLocked()
+	g.mu.Unlock()
+
+	for _, f := range failed {
+		g.host.SendToPlayer(g, f.PlayerID, "error", f.Err.Error())
+	}
+	for _, ev := range events {
+		g.host.Broadcast(g, ev.Type, ev.Payload)
+	}
+	if finished {
+		g.host.GameFinished(g, state)
+	}
+	g.host.Broadcast(g, "gameState", state)
+}
+
+// accept applies input and, if the game took it, appends it to the match
+// record.
+func (g *Game) accept(input Input, ai bool) error {
+	if err := g.applyInput(input); err != nil {
+		return err
+	}
+	g.record = append(g.record, RecordedInput{Tick: g.Tick, Input: input, AI: ai})
+	return nil
+}
+
+func (g *Game) applyInput(input Input) error {
+	switch input.Type {
+	case INPUT_MOVE:
+		return g.movePlayer(input.PlayerID, input.Direction)
+	case INPUT_PLACE_BOMB:
+		return g.placeBomb(input.PlayerID)
+	case INPUT_DASH:
+		return g.dash(input.PlayerID, input.Direction)
+	case INPUT_REMOTE_DETONATE:
+		return g.remoteDetonate(input.PlayerID)
+	case INPUT_LEAVE:
+		return g.leave(input.PlayerID)
+	case INPUT_AI_CONTROL:
+		return g.aiControl(input.PlayerID, input.Difficulty)
+	case INPUT_HUMAN_CONTROL:
+		return g.humanControl(input.PlayerID)
+	default:
+		return fmt.Errorf("unknown input: %s", input.Type)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (g *Game) movePlayer(playerID, direction string) error {
+	player, exists := g.Players[playerID]
+	if !exists {
+
+		return errors.New("player not found")
+	}
+
+	if !player.Alive {
+		return errors.New("player not alive")
+	}
+
+	if !g.moveReady(playerID, g.now()) {
+		return errMoveTooSoon
+	}
+
+	newPos := player.Position
+	switch direction {
+	case "up":
+		newPos.Row--
+	case "down":
+		newPos.Row++
+	case "left":
+		newPos.Col--
+	case "right":
+		newPos.Col++
+	default:
+		return errors.New("invalid direction")
+	}
+
+	if !g.isValidPosition(newPos) {
+		return errors.New("invalid move")
+	}
+
+	if _, ok := player.Powerups[POWERUP_KICK]; ok {
+		if bomb := g.bombAt(newPos); bomb != nil {
+			return g.kickBomb(player, bomb, direction)
+		}
+	}
+
+	cellValue := g.Board[newPos.Row][newPos.Col]
+
+	if cellValue == 0 {
+		player.Position = newPos
+		player.LastMove = g.now()
+
+		for _, powerupID := range sortedKeys(g.Powerups) {
+			if g.Powerups[powerupID].Position == newPos {
+				g.collectPowerup(playerID, powerupID)
+			}
+		}
+
+		return nil
+	}
+
+	return errors.New("invalid move")
+}
+
+func (g *Game) remoteDetonate(playerID string) error {
+	for _, id := range sortedKeys(g.Bombs) {
+		if g.Bombs[id].PlayerID == playerID {
+			g.detonations = append(g.detonations, id)
+		}
+	}
+
+	return nil
+}
+
+func (g *Game) dash(playerID, direction string) error {
+	player, exists := g.Players[playerID]
+	if !exists || !player.Alive {
+		return errors.New("player not found or not alive")
+	}
+
+	if g.now().Sub(player.LastDash) < g.Rules.DashCooldown {
+		return errors.New("dash on cooldown")
+	}
+
+	cur := player.Position
+	var furthest Position
+	furthest = cur
+
+	for i := 1; ; i++ {
+		next := cur
+		switch direction {
+		case "up":
+			next.Row = cur.Row - i
+		case "down":
+			next.Row = cur.Row + i
+		case "left":
+			next.Col = cur.Col - i
+		case "right":
+			next.Col = cur.Col + i
+		default:
+			return errors.New("invalid direction")
+		}
+		if !g.isValidPosition(next) {
+			break
+		}
+		if g.Board[next.Row][next.Col] != 0 {
+			break
+		}
+		blocked := false
+		for _, bomb := range g.Bombs {
+			if bomb.Position == next {
+				blocked = true
+				break
+			}
+		}
+		if blocked {
+			break
+		}
+		furthest = next
+	}
+
+	if furthest == cur {
+		return errors.New("no available dash target")
+	}
+
+	player.Position = furthest
+	player.LastDash = g.now()
+
+	for _, powerupID := range sortedKeys(g.Powerups) {
+		if g.Powerups[powerupID].Position == furthest {
+			g.collectPowerup(playerID, powerupID)
+		}
+	}
+
+	return nil
+}
+
+func (g *Game) placeBomb(playerID string) error {
+	player, exists := g.Players[playerID]
+	if !exists || !player.Alive {
+		return errors.New("player not found or not alive")
+	}
+
+	var latest *Bomb
+	count := 0
+	for _, bombID := range sortedKeys(g.Bombs) {
+		bomb := g.Bombs[bombID]
+		if bomb.PlayerID != playerID {
+			continue
+		}
+		count++
+		if latest == nil || bomb.PlacedAt.After(latest.PlacedAt) {
+			latest = bomb
+		}
+	}
+
+	if count >= player.MaxBombs {
+		if latest != nil {
+			g.detonations = append(g.detonations, latest.ID)
+		}
+		return nil
+	}
+
+	g.seq++
+	bombID := fmt.Sprintf("bomb_%s_%d", playerID, g.seq)
+	now := g.now()
+	bomb := &Bomb{
+		ID:       bombID,
+		Type:     BOMB_NORMAL,
+		PlayerID: playerID,
+		Position: player.Position,
+		Range:    player.BombRange,
+		PlacedAt: now,
+		FuseEnd:  now.Add(g.Rules.fuseDuration(BOMB_NORMAL)),
+	}
+	if _, ok := player.Powerups[POWERUP_PIERCE]; ok {
+		bomb.Pierce = true
+	}
+
+	g.Bombs[bombID] = bomb
+	return nil
+}
+
+func (g *Game) queueDueFuses(now time.Time) {
+	var due []*Bomb
+	for _, bomb := range g.Bombs {
+		if !now.Before(bomb.FuseEnd) {
+			due = append(due, bomb)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].FuseEnd.Equal(due[j].FuseEnd) {
+			return due[i].FuseEnd.Before(due[j].FuseEnd)
+		}
+		return due[i].ID < due[j].ID
+	})
+	for _, bomb := range due {
+		g.detonations = append(g.detonations, bomb.ID)
+	}
+}
+
+// resolveDetonations explodes queued bombs in FIFO order. Bombs caught in a
+// blast are appended to the same queue, so chain reactions resolve
+// breadth-first within the tick.
+func (g *Game) resolveDetonations() {
+	for len(g.detonations) > 0 {
+		bombID := g.detonations[0]
+		g.detonations = g.detonations[1:]
+		g.explodeBombInternal(bombID)
+	}
+}
+
+func (g *Game) isValidPosition(pos Position) bool {
+	return pos.Row >= 0 && pos.Row < len(g.Board) && pos.Col >= 0 && pos.Col < len(g.Board[0])
+}
+
+func (g *Game) isValidMove(playerID, direction string) bool {
+	player, exists := g.Players[playerID]
+	if !exists {
+		return false
+	}
+
+	newPos := player.Position
+	switch direction {
+	case "up":
+		newPos.Row--
+	case "down":
+		newPos.Row++
+	case "left":
+		newPos.Col--
+	case "right":
+		newPos.Col++
+	default:
+		return false
+	}
+
+	if !g.isValidPosition(newPos) {
+		return false
+	}
+	cellValue := g.Board[newPos.Row][newPos.Col]
+	if cellValue != 0 {
+		return false
+	}
+	for _, bomb := range g.Bombs {
+		if bomb.Position == newPos && bomb.PlayerID != playerID {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (g *Game) queueBombsAt(pos Position) {
+	for _, bombID := range sortedKeys(g.Bombs) {
+		if g.Bombs[bombID].Position == pos {
+			g.detonations = append(g.detonations, bombID)
+		}
+	}
+}
+
+func (g *Game) hitPlayersAt(pos Position, chain *ChainExplosion) {
+	for _, playerID := range sortedKeys(g.Players) {
+		player := g.Players[playerID]
+		if !player.Alive || player.Position != pos {
+			continue
+		}
+		teammate := player.ID != chain.PlayerID && g.sameTeam(player.ID, chain.PlayerID)
+		if teammate && !g.Rules.FriendlyFire {
+			continue
+		}
+		if player.Shield {
+			player.Shield = false
+			continue
+		}
+		g.killPlayer(player)
+		if teammate {
+			chain.TeamKills++
+		} else if player.ID != chain.PlayerID {
+			chain.PlayersKilled++
+		}
+	}
+}
+
+func (g *Game) explodeBombInternal(bombID string) {
+	bomb, exists := g.Bombs[bombID]
+	if !exists {
+		return
+	}
+	delete(g.Bombs, bombID)
+
+	chainExplosion := &ChainExplosion{
+		OriginalBombID: bombID,
+		PlayerID:       bomb.PlayerID,
+		TilesDestroyed: 0,
+		PlayersKilled:  0,
+	}
+
+	endTime := g.now().Add(g.Rules.ExplosionLifetime)
+	explosionID := g.nextID("explosion")
+	g.Explosions[explosionID] = &Explosion{
+		ID:       explosionID,
+		Position: bomb.Position,
+		EndTime:  endTime,
+	}
+
+	g.burnPowerupsAt(bomb.Position)
+	g.hitPlayersAt(bomb.Position, chainExplosion)
+	g.queueBombsAt(bomb.Position)
+
+	directions := []Position{
+		{Row: -1, Col: 0},
+		{Row: 1, Col: 0},
+		{Row: 0, Col: -1},
+		{Row: 0, Col: 1},
+	}
+
+	for _, dir := range directions {
+		for i := 1; i <= bomb.Range; i++ {
+			explosionPos := Position{
+				Row: bomb.Position.Row + dir.Row*i,
+				Col: bomb.Position.Col + dir.Col*i,
+			}
+			if !g.isValidPosition(explosionPos) {
+				break
+			}
+			cell := g.Board[explosionPos.Row][explosionPos.Col]
+			if cell == 1 {
+				break
+			}
+			dirExplosionID := g.nextID("explosion")
+			g.Explosions[dirExplosionID] = &Explosion{
+				ID:       dirExplosionID,
+				Position: explosionPos,
+				EndTime:  endTime,
+			}
+			if cell == 2 {
+				g.Board[explosionPos.Row][explosionPos.Col] = 0
+				chainExplosion.TilesDestroyed++
+				g.dropPowerup(explosionPos)
+
+				for _, powerupID := range sortedKeys(g.Powerups) {
+					if g.Powerups[powerupID].Position != explosionPos {
+						continue
+					}
+					for _, playerID := range sortedKeys(g.Players) {
+						player := g.Players[playerID]
+						if player.Alive && player.Position == explosionPos {
+							g.collectPowerup(player.ID, powerupID)
+							break
+						}
+					}
+				}
+			}
+			if cell == 0 {
+				g.burnPowerupsAt(explosionPos)
+			}
+			g.hitPlayersAt(explosionPos, chainExplosion)
+			g.queueBombsAt(explosionPos)
+			if cell == 2 && !bomb.Pierce {
+				break
+			}
+		}
+	}
+
+	g.awardPoints(chainExplosion)
+}
+
+func (g *Game) expireExplosions(now time.Time) {
+	for id, explosion := range g.Explosions {
+		if !now.Before(explosion.EndTime) {
+			delete(g.Explosions, id)
+		}
+	}
+}
+
+func (g *Game) awardPoints(chain *ChainExplosion) {
+	player, exists := g.Players[chain.PlayerID]
+	if !exists {
+		return
+	}
+
+	baseTilePoints := chain.TilesDestroyed * g.Rules.TilePoints
+	playerKillPoints := chain.PlayersKilled * g.Rules.KillPoints
+
+	tilePoints := int(float64(baseTilePoints) * g.Rules.chainMultiplier(chain.TilesDestroyed))
+	totalPoints := tilePoints + playerKillPoints - chain.TeamKills*g.Rules.TeamkillPenalty
+
+	player.Score = max(0, player.Score+totalPoints)
+
+	stats := g.stat(player.ID)
+	stats.TilesDestroyed += chain.TilesDestroyed
+	stats.Kills += chain.PlayersKilled
+	stats.TeamKills += chain.TeamKills
+}
+
+// checkWinCondition ends an elimination round as soon as at most one
+// player is left standing. It runs once per tick, after every detonation
+// has resolved, so players caught in the same chain go out together.
+func (g *Game) checkWinCondition(now time.Time) {
+	if g.Status == "finished" || (!g.Rules.elimination() && !g.suddenDeathStarted()) {
+		return
+	}
+
+	standing := make(map[string]bool)
+	for _, player := range g.Players {
+		if !player.Spectator {
+			standing[g.side(player)] = true
+		}
+	}
+	if len(standing) <= 1 && g.sides() > 1 {
+		g.finishRound(now)
+	}
+}
+
+// roundOver reports whether the round has run its course: on the clock,
+// or once the sudden-death spiral has closed.
+func (g *Game) roundOver(now time.Time) bool {
+	if g.Rules.SuddenDeath.Enabled {
+		return g.suddenDeathComplete()
+	}
+	return !now.Before(g.StartTime.Add(g.Rules.RoundDuration))
+}
+
+// killPlayer respawns player, or in elimination mode takes a life and turns
+// them into a spectator once they have none left. Nobody respawns once
+// sudden death has begun.
+func (g *Game) killPlayer(player *Player) {
+	g.stat(player.ID).Deaths++
+	if g.suddenDeathStarted() {
+		g.eliminatePlayer(player)
+		return
+	}
+	if !g.Rules.elimination() {
+		g.respawnPlayer(player.ID)
+		return
+	}
+
+	player.Lives--
+	if player.Lives > 0 {
+		g.respawnPlayer(player.ID)
+		return
+	}
+	g.eliminatePlayer(player)
+}
+
+func (g *Game) eliminatePlayer(player *Player) {
+	player.Lives = 0
+	player.Alive = false
+	player.Spectator = true
+	player.Shield = false
+	delete(g.nextAIMove, player.ID)
+	g.events = append(g.events, Event{Type: "playerEliminated", Payload: map[string]interface{}{
+		"playerId": player.ID,
+		"score":    player.Score,
+	}})
+}
+
+// leave takes a player out of the round for good. They keep their score
+// but count as eliminated, so the others can still win by outlasting them.
+func (g *Game) leave(playerID string) error {
+	player, exists := g.Players[playerID]
+	if !exists {
+		return errors.New("player not found")
+	}
+	if player.Spectator {
+		return nil
+	}
+	g.eliminatePlayer(player)
+	g.events = append(g.events, Event{Type: "playerLeft", Payload: playerID})
+	return nil
+}
+
+// aiControl hands a player's character to the AI, keeping its score and
+// powerups, until humanControl gives it back.
+func (g *Game) aiControl(playerID, difficulty string) error {
+	player, exists := g.Players[playerID]
+	if !exists {
+		return errors.New("player not found")
+	}
+	player.IsAI = true
+	player.AIDifficulty = difficulty
+	if g.replay == nil && !player.Spectator {
+		g.scheduleAIMove(playerID)
+	}
+	g.events = append(g.events, Event{Type: "aiTakeover", Payload: map[string]interface{}{
+		"playerId":   playerID,
+		"difficulty": difficulty,
+	}})
+	return nil
+}
+
+func (g *Game) humanControl(playerID string) error {
+	player, exists := g.Players[playerID]
+	if !exists {
+		return errors.New("player not found")
+	}
+	if !player.IsAI {
+		return nil
+	}
+	player.IsAI = false
+	player.AIDifficulty = ""
+	delete(g.nextAIMove, playerID)
+	g.events = append(g.events, Event{Type: "aiHandback", Payload: map[string]interface{}{
+		"playerId": playerID,
+	}})
+	return nil
+}
+
+func (g *Game) respawnPlayer(playerID string) {
+	player, exists := g.Players[playerID]
+	if !exists {
+		return
+	}
+
+	player.Score = max(0, player.Score-g.Rules.RespawnPenalty)
+	player.Position = player.SpawnPosition
+	player.Alive = true
+	player.BombCount = 0
+	player.Shield = false
+}
+
+func (g *Game) finishRound(now time.Time) {
+	g.Status = "finished"
+	g.EndTime = now
+
+	if g.Rules.elimination() || g.suddenDeathStarted() {
+		g.Winner = g.lastStanding()
+	} else if g.Rules.TeamMode() {
+		g.Winner = g.topTeam()
+	} else {
+		var winner string
+		var maxScore int
+		for _, playerID := range sortedKeys(g.Players) {
+			player := g.Players[playerID]
+			if player.Score > maxScore {
+				maxScore = player.Score
+				winner = playerID
+			}
+		}
+		g.Winner = winner
+	}
+	g.nextAIMove = make(map[string]time.Time)
+}
+
+func (g *Game) end() {
+	g.Stop()
+
+	g.mu.Lock()
+	g.nextAIMove = nil
+	g.Players = nil
+	g.Bombs = nil
+	g.Explosions = nil
+	g.Powerups = nil
+	g.mu.Unlock()
+
+	g.host.GameEnded(g)
+}
+
+// lastStanding picks the elimination winner: the player or team with the
+// most lives left, then the highest score. Nobody wins if everyone is out.
+func (g *Game) lastStanding() string {
+	lives := make(map[string]int)
+	scores := make(map[string]int)
+	for _, player := range g.Players {
+		if player.Spectator {
+			continue
+		}
+		side := g.side(player)
+		lives[side] += player.Lives
+		scores[side] += player.Score
+	}
+
+	var winner string
+	for _, side := range sortedKeys(lives) {
+		if winner == "" || lives[side] > lives[winner] ||
+			(lives[side] == lives[winner] && scores[side] > scores[winner]) {
+			winner = side
+		}
+	}
+	return winner
+}
+
+func (g *Game) topTeam() string {
+	var winner string
+	maxScore := 0
+	scores := g.teamScores()
+	for team := 1; team <= g.Rules.Teams; team++ {
+		if scores[team] > maxScore {
+			maxScore = scores[team]
+			winner = TeamWinner(team)
+		}
+	}
+	return winner
+}
+
+// TeamWinner is how a winning team is written in Game.Winner, so it can't
+// be mistaken for a player ID.
+func TeamWinner(team int) string {
+	return fmt.Sprintf("team:%d", team)
+}
+
+// side is who a player wins or loses with: their team in team mode,
+// otherwise just themselves.
+func (g *Game) side(player *Player) string {
+	if g.Rules.TeamMode() && player.Team > 0 {
+		return TeamWinner(player.Team)
+	}
+	return player.ID
+}
+
+func (g *Game) sides() int {
+	sides := make(map[string]bool)
+	for _, player := range g.Players {
+		sides[g.side(player)] = true
+	}
+	return len(sides)
+}
+
+func (g *Game) sameTeam(a, b string) bool {
+	if !g.Rules.TeamMode() {
+		return false
+	}
+	pa, okA := g.Players[a]
+	pb, okB := g.Players[b]
+	return okA && okB && pa.Team > 0 && pa.Team == pb.Team
+}
+
+func (g *Game) teamScores() map[int]int {
+	if !g.Rules.TeamMode() {
+		return nil
+	}
+	scores := make(map[int]int)
+	for team := 1; team <= g.Rules.Teams; team++ {
+		scores[team] = 0
+	}
+	for _, player := range g.Players {
+		if player.Team > 0 {
+			scores[player.Team] += player.Score
+		}
+	}
+	return scores
+}
+
+// moveReady reports whether the player's move interval has elapsed.
+func (g *Game) moveReady(playerID string, now time.Time) bool {
+	player, exists := g.Players[playerID]
+	if !exists {
+		return true
+	}
+	return !now.Before(player.LastMove.Add(g.MoveInterval(player)))
+}
+
+// MoveInterval is how long player actually waits between moves: their move
+// interval rounded up to whole ticks. The unboosted interval spans at least
+// one tick more than there are speed stacks, and each stack takes at least
+// a tick off, so speed pays off at any tick rate.
+func (g *Game) MoveInterval(player *Player) time.Duration {
+	tick := g.Rules.TickInterval()
+	inTicks := func(d time.Duration) time.Duration {
+		return (d + tick - 1) / tick
+	}
+	stacks := 0
+	if held, ok := player.Powerups[POWERUP_SPEED]; ok {
+		stacks = held.Stacks
+	}
+	ticks := max(inTicks(baseMoveInterval), maxSpeedStacks+1)
+	for s := 1; s <= stacks; s++ {
+		ticks = min(max(inTicks(speedInterval(s)), time.Duration(maxSpeedStacks+1-s)), ticks-1)
+	}
+	return max(ticks, 1) * tick
+}
+
+// requeueEarlyMoves puts moves that arrived before the player's interval
+// was up back on the queue, keeping only the latest one per player so a
+// client can't build up a backlog.
+func (g *Game) requeueEarlyMoves(early []Input) {
+	if len(early) == 0 {
+		return
+	}
+	latest := make(map[string]int)
+	for i, input := range early {
+		latest[input.PlayerID] = i
+	}
+	var keep []Input
+	for i, input := range early {
+		if latest[input.PlayerID] == i {
+			keep = append(keep, input)
+		}
+	}
+
+	g.inputMu.Lock()
+	g.inputs = append(keep, g.inputs...)
+	g.inputMu.Unlock()
+}
+
+func (g *Game) bombAt(pos Position) *Bomb {
+	for _, bombID := range sortedKeys(g.Bombs) {
+		if g.Bombs[bombID].Position == pos {
+			return g.Bombs[bombID]
+		}
+	}
+	return nil
+}
+
+// kickBomb sets bomb sliding away from player. The player stays put; the
+// bomb moves one tile per tick in slideBombs until something stops it.
+func (g *Game) kickBomb(player *Player, bomb *Bomb, direction string) error {
+	if !g.canSlideInto(g.getNewPosition(bomb.Position, direction)) {
+		return errors.New("invalid move")
+	}
+	bomb.Sliding = direction
+	player.LastMove = g.now()
+	return nil
+}
+
+func (g *Game) slideBombs() {
+	for _, bombID := range sortedKeys(g.Bombs) {
+		bomb := g.Bombs[bombID]
+		if bomb.Sliding == "" {
+			continue
+		}
+		next := g.getNewPosition(bomb.Position, bomb.Sliding)
+		if !g.canSlideInto(next) {
+			bomb.Sliding = ""
+			continue
+		}
+		bomb.Position = next
+	}
+}
+
+// canSlideInto reports whether a kicked bomb can enter pos: open floor with
+// no other bomb and no living player on it.
+func (g *Game) canSlideInto(pos Position) bool {
+	if !g.isValidPosition(pos) || g.Board[pos.Row][pos.Col] != 0 {
+		return false
+	}
+	if g.bombAt(pos) != nil {
+		return false
+	}
+	for _, player := range g.Players {
+		if player.Alive && player.Position == pos {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,363 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestGame is a game on an open board: walls and pillars only.
+func newTestGame(t *testing.T, seed int64) *Game {
+	t.Helper()
+	g := NewGame("test", "lobby", seed, DefaultGameRules(), nil)
+	for _, row := range g.Board {
+		for col := range row {
+			if row[col] == 2 {
+				row[col] = 0
+			}
+		}
+	}
+	return g
+}
+
+var testStart = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// scriptedInputs is a human's inputs keyed by the tick they are sent on.
+type scriptedInputs map[int64][]Input
+
+// playScripted runs a three-player match, one human following script and
+// two AIs, for ticks ticks from a fixed start time.
+func playScripted(t *testing.T, seed int64, ticks int64, script scriptedInputs) *Game {
+	t.Helper()
+	g := NewGame("test", "lobby", seed, DefaultGameRules(), nil)
+	g.StartTime = testStart
+	spawns := g.SpawnPositions()
+	g.AddPlayer(Player{ID: "human", Name: "Human"}, spawns[0])
+	g.AddPlayer(Player{ID: "ai_1", Name: "AI 1", IsAI: true, AIDifficulty: AI_HARD}, spawns[1])
+	g.AddPlayer(Player{ID: "ai_2", Name: "AI 2", IsAI: true, AIDifficulty: AI_MEDIUM}, spawns[2])
+	for tick := int64(0); tick < ticks; tick++ {
+		for _, input := range script[tick] {
+			g.Enqueue(input)
+		}
+		g.Step()
+	}
+	return g
+}
+
+func stateJSON(t *testing.T, g *Game) []byte {
+	t.Helper()
+	data, err := json.Marshal(g.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func humanInput(inputType, direction string) Input {
+	return Input{Type: inputType, PlayerID: "human", Direction: direction}
+}
+
+var walkAndBomb = scriptedInputs{
+	1:  {humanInput(INPUT_MOVE, "right")},
+	5:  {humanInput(INPUT_PLACE_BOMB, "")},
+	6:  {humanInput(INPUT_MOVE, "left")},
+	10: {humanInput(INPUT_MOVE, "down")},
+	80: {humanInput(INPUT_DASH, "right")},
+}
+
+func TestDeterminism(t *testing.T) {
+	tests := []struct {
+		name   string
+		seed   int64
+		ticks  int64
+		script scriptedInputs
+	}{
+		{name: "AI only", seed: 1, ticks: 400},
+		{name: "with human inputs", seed: 42, ticks: 400, script: walkAndBomb},
+		{name: "full round", seed: 7, ticks: 2500, script: walkAndBomb},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := playScripted(t, tt.seed, tt.ticks, tt.script)
+			b := playScripted(t, tt.seed, tt.ticks, tt.script)
+			if !bytes.Equal(stateJSON(t, a), stateJSON(t, b)) {
+				t.Error("two runs with the same seed and inputs ended in different states")
+			}
+			if len(a.Replay().Inputs) == 0 {
+				t.Error("no inputs were recorded")
+			}
+		})
+	}
+
+	t.Run("different seeds", func(t *testing.T) {
+		a := playScripted(t, 1, 1, nil)
+		b := playScripted(t, 2, 1, nil)
+		if bytes.Equal(stateJSON(t, a), stateJSON(t, b)) {
+			t.Error("different seeds produced the same state")
+		}
+	})
+}
+
+// testBomb is a bomb in the top row of an open board.
+type testBomb struct {
+	col    int
+	owner  string
+	rng    int
+	fuseIn time.Duration
+}
+
+func explosionSeq(id string) int {
+	n, _ := strconv.Atoi(id[strings.LastIndex(id, "_")+1:])
+	return n
+}
+
+func TestChainDetonationOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		bombs     []testBomb
+		softCols  []int
+		wantOrder []int // columns of the bombs that go off, in order
+		wantLeft  int
+		wantScore map[string]int
+	}{
+		{
+			name:      "single bomb",
+			bombs:     []testBomb{{col: 1, owner: "p1", rng: 1}},
+			wantOrder: []int{1},
+		},
+		{
+			name: "chain runs outward from the first bomb",
+			bombs: []testBomb{
+				{col: 7, owner: "p1", rng: 2, fuseIn: 8 * time.Second},
+				{col: 3, owner: "p1", rng: 2},
+				{col: 5, owner: "p2", rng: 2, fuseIn: 8 * time.Second},
+			},
+			wantOrder: []int{3, 5, 7},
+		},
+		{
+			name: "chain resolves breadth-first",
+			bombs: []testBomb{
+				{col: 1, owner: "p2", rng: 1, fuseIn: 8 * time.Second},
+				{col: 7, owner: "p2", rng: 1, fuseIn: 8 * time.Second},
+				{col: 5, owner: "p1", rng: 2},
+				{col: 3, owner: "p1", rng: 2, fuseIn: 8 * time.Second},
+			},
+			wantOrder: []int{5, 3, 7, 1},
+		},
+		{
+			name: "due fuses go off earliest first",
+			bombs: []testBomb{
+				{col: 9, owner: "p2", rng: 1, fuseIn: -time.Second},
+				{col: 1, owner: "p1", rng: 1},
+			},
+			wantOrder: []int{9, 1},
+		},
+		{
+			name: "soft block stops the chain",
+			bombs: []testBomb{
+				{col: 1, owner: "p1", rng: 3},
+				{col: 4, owner: "p2", rng: 1, fuseIn: 8 * time.Second},
+			},
+			softCols:  []int{2},
+			wantOrder: []int{1},
+			wantLeft:  1,
+			wantScore: map[string]int{"p1": 10, "p2": 0},
+		},
+		{
+			name: "each bomb scores for its owner",
+			bombs: []testBomb{
+				{col: 1, owner: "p1", rng: 2},
+				{col: 3, owner: "p2", rng: 2, fuseIn: 8 * time.Second},
+			},
+			softCols:  []int{5},
+			wantOrder: []int{1, 3},
+			wantScore: map[string]int{"p1": 0, "p2": 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGame(t, 1)
+			g.Powerups = make(map[string]*Powerup)
+			g.AddPlayer(Player{ID: "p1"}, Position{Row: 13, Col: 1})
+			g.AddPlayer(Player{ID: "p2"}, Position{Row: 13, Col: 13})
+			for _, col := range tt.softCols {
+				g.Board[1][col] = 2
+			}
+			// Steps run at now+1 tick, so a zero fuseIn is due on the first.
+			now := g.now()
+			for i, b := range tt.bombs {
+				id := "bomb_" + b.owner + "_" + strconv.Itoa(i+1)
+				g.Bombs[id] = &Bomb{
+					ID:       id,
+					Type:     BOMB_NORMAL,
+					PlayerID: b.owner,
+					Position: Position{Row: 1, Col: b.col},
+					Range:    b.rng,
+					FuseEnd:  now.Add(b.fuseIn),
+				}
+			}
+
+			g.Step()
+
+			// Bombs sit on odd columns, so the only blast that reaches the
+			// tile below a bomb is its own. Ordering those by explosion ID
+			// gives the order the bombs went off in.
+			order := make(map[int]int)
+			for id, e := range g.Explosions {
+				if e.Position.Row == 2 {
+					order[e.Position.Col] = explosionSeq(id)
+				}
+			}
+			for _, col := range tt.wantOrder {
+				if _, ok := order[col]; !ok {
+					t.Fatalf("bomb at column %d did not go off", col)
+				}
+			}
+			for i := 1; i < len(tt.wantOrder); i++ {
+				prev, cur := tt.wantOrder[i-1], tt.wantOrder[i]
+				if order[prev] >= order[cur] {
+					t.Errorf("bomb at column %d went off after column %d", prev, cur)
+				}
+			}
+			if len(g.Bombs) != tt.wantLeft {
+				t.Errorf("%d bombs left, want %d", len(g.Bombs), tt.wantLeft)
+			}
+			for id, want := range tt.wantScore {
+				if got := g.Players[id].Score; got != want {
+					t.Errorf("%s scored %d, want %d", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSoftBlockDrops(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(r *GameRules)
+		want   string // type of the powerup dropped, "" for none
+	}{
+		{name: "off by default", modify: func(r *GameRules) {}},
+		{name: "weighted by registry", modify: func(r *GameRules) {
+			r.DropChance = 1
+			r.DisabledPowerups = []string{POWERUP_BOMB_RANGE, POWERUP_EXTRA_BOMB, POWERUP_SPEED, POWERUP_KICK}
+		}, want: POWERUP_PIERCE},
+		{name: "lobby weights", modify: func(r *GameRules) {
+			r.DropChance = 1
+			r.DropWeights = map[string]int{POWERUP_SPEED: 1, POWERUP_KICK: 0}
+		}, want: POWERUP_SPEED},
+		{name: "weighted type disabled", modify: func(r *GameRules) {
+			r.DropChance = 1
+			r.DropWeights = map[string]int{POWERUP_SPEED: 1}
+			r.DisabledPowerups = []string{POWERUP_SPEED}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGame(t, 1)
+			g.Powerups = make(map[string]*Powerup)
+			tt.modify(&g.Rules)
+			g.AddPlayer(Player{ID: "p1"}, Position{Row: 13, Col: 1})
+			g.Board[1][2] = 2
+			g.Bombs["bomb_p1_1"] = &Bomb{
+				ID: "bomb_p1_1", Type: BOMB_NORMAL, PlayerID: "p1",
+				Position: Position{Row: 1, Col: 1}, Range: 2, FuseEnd: g.now(),
+			}
+
+			g.Step()
+
+			if g.Board[1][2] != 0 {
+				t.Fatal("soft block was not destroyed")
+			}
+			var got []string
+			for _, p := range g.Powerups {
+				if p.Position != (Position{Row: 1, Col: 2}) {
+					t.Errorf("%s dropped at %v", p.Type, p.Position)
+				}
+				got = append(got, p.Type)
+			}
+			if tt.want == "" && len(got) != 0 {
+				t.Errorf("dropped %v, want nothing", got)
+			}
+			if tt.want != "" && (len(got) != 1 || got[0] != tt.want) {
+				t.Errorf("dropped %v, want one %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeatInputs(t *testing.T) {
+	t.Run("AI takes over", func(t *testing.T) {
+		g := playScripted(t, 1, 3, scriptedInputs{
+			1: {{Type: INPUT_AI_CONTROL, PlayerID: "human", Difficulty: AI_EASY}},
+		})
+		if p := g.Players["human"]; !p.IsAI || p.AIDifficulty != AI_EASY || !p.Alive {
+			t.Errorf("player after takeover: %+v", p)
+		}
+	})
+	t.Run("human takes back", func(t *testing.T) {
+		g := playScripted(t, 1, 4, scriptedInputs{
+			1: {{Type: INPUT_AI_CONTROL, PlayerID: "human", Difficulty: AI_EASY}},
+			2: {humanInput(INPUT_HUMAN_CONTROL, "")},
+		})
+		if p := g.Players["human"]; p.IsAI || p.AIDifficulty != "" {
+			t.Errorf("player after handback: %+v", p)
+		}
+		if _, scheduled := g.nextAIMove["human"]; scheduled {
+			t.Error("AI still has a move scheduled for the player")
+		}
+	})
+	t.Run("leave", func(t *testing.T) {
+		g := playScripted(t, 1, 3, scriptedInputs{1: {humanInput(INPUT_LEAVE, "")}})
+		if p := g.Players["human"]; p.Alive || !p.Spectator {
+			t.Errorf("player after leaving: %+v", p)
+		}
+		if _, ok := g.Players["ai_1"]; !ok || !g.Players["ai_1"].Alive {
+			t.Error("leaving took another player with it")
+		}
+	})
+}
+
+// TestSpeedStacks checks that every speed stack shortens the time between
+// moves, even at tick rates too coarse for the raw boost to show.
+func TestSpeedStacks(t *testing.T) {
+	for _, rate := range []int{20, 5} {
+		t.Run(strconv.Itoa(rate)+"Hz", func(t *testing.T) {
+			last := int64(-1)
+			for stacks := 0; stacks <= maxSpeedStacks; stacks++ {
+				g := newTestGame(t, 1)
+				g.Rules.TickRate = rate
+				g.AddPlayer(Player{ID: "p1"}, Position{Row: 1, Col: 1})
+				for i := 0; i < stacks; i++ {
+					id := "speed_" + strconv.Itoa(i)
+					g.Powerups[id] = &Powerup{ID: id, Type: POWERUP_SPEED}
+					g.collectPowerup("p1", id)
+				}
+
+				var moves []int64
+				for len(moves) < 2 && g.Tick < 100 {
+					g.Enqueue(Input{Type: INPUT_MOVE, PlayerID: "p1", Direction: "right"})
+					col := g.Players["p1"].Position.Col
+					g.Step()
+					if g.Players["p1"].Position.Col != col {
+						moves = append(moves, g.Tick)
+					}
+				}
+				if len(moves) < 2 {
+					t.Fatalf("%d stacks: moved on ticks %v only", stacks, moves)
+				}
+				interval := moves[1] - moves[0]
+				if last >= 0 && interval >= last {
+					t.Errorf("%d stacks: %d ticks between moves, want fewer than %d", stacks, interval, last)
+				}
+				last = interval
+			}
+		})
+	}
+}
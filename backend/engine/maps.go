@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	MinMapSize = 5
+
+	MAP_WALL  = '#'
+	MAP_SOFT  = '+'
+	MAP_FLOOR = '.'
+)
+
+// Map is a hand-authored arena. Tiles holds one string per row using
+// '#' for walls, '+' for soft blocks and '.' for floor; the digits '1'-'8'
+// mark floor cells that are spawn points, assigned to players in that order.
+type Map struct {
+	Name               string       `json:"name"`
+	Author             string       `json:"author"`
+	RecommendedPlayers int          `json:"recommendedPlayers"`
+	Tiles              []string     `json:"tiles"`
+	Powerups           []MapPowerup `json:"powerups,omitempty"`
+}
+
+// MapPowerup is a fixed powerup spawn. Fixed spawns replace the random ring
+// around the centre; each wave places them again at the wave's level.
+type MapPowerup struct {
+	Type     string   `json:"type"`
+	Position Position `json:"position"`
+}
+
+func ParseMap(data []byte) (*Map, error) {
+	var m Map
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid map file: %v", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m *Map) Width() int {
+	if len(m.Tiles) == 0 {
+		return 0
+	}
+	return len(m.Tiles[0])
+}
+
+func (m *Map) Height() int {
+	return len(m.Tiles)
+}
+
+// Validate checks that the map is a closed rectangle whose spawns are
+// numbered without gaps and can all reach each other once soft blocks are
+// cleared.
+func (m *Map) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("map name is required")
+	}
+	height, width := m.Height(), m.Width()
+	if height < MinMapSize || height > MaxBoardSize || width < MinMapSize || width > MaxBoardSize {
+		return fmt.Errorf("map must be between %dx%d and %dx%d tiles", MinMapSize, MinMapSize, MaxBoardSize, MaxBoardSize)
+	}
+
+	spawns := make(map[int]Position)
+	for row, line := range m.Tiles {
+		if len(line) != width {
+			return fmt.Errorf("map row %d has %d tiles, expected %d", row, len(line), width)
+		}
+		for col := 0; col < width; col++ {
+			c := line[col]
+			border := row == 0 || row == height-1 || col == 0 || col == width-1
+			if border && c != MAP_WALL {
+				return fmt.Errorf("map border is open at row %d, column %d", row, col)
+			}
+			switch {
+			case c == MAP_WALL, c == MAP_SOFT, c == MAP_FLOOR:
+			case c >= '1' && c <= '8':
+				n := int(c - '0')
+				if _, dup := spawns[n]; dup {
+					return fmt.Errorf("spawn %d is defined more than once", n)
+				}
+				spawns[n] = Position{Row: row, Col: col}
+			default:
+				return fmt.Errorf("invalid map tile %q at row %d, column %d", c, row, col)
+			}
+		}
+	}
+
+	if len(spawns) == 0 {
+		return fmt.Errorf("map has no spawn points")
+	}
+	for n := 1; n <= len(spawns); n++ {
+		if _, ok := spawns[n]; !ok {
+			return fmt.Errorf("spawn points must be numbered 1 to %d without gaps", len(spawns))
+		}
+	}
+	if m.RecommendedPlayers < 0 || m.RecommendedPlayers > len(spawns) {
+		return fmt.Errorf("recommended player count %d exceeds the %d spawn points", m.RecommendedPlayers, len(spawns))
+	}
+
+	reachable := m.reachableFrom(spawns[1])
+	for n := 2; n <= len(spawns); n++ {
+		if !reachable[spawns[n]] {
+			return fmt.Errorf("spawn %d cannot be reached from spawn 1", n)
+		}
+	}
+
+	for i, p := range m.Powerups {
+		if _, ok := LookupPowerup(p.Type); !ok {
+			return fmt.Errorf("powerup %d has unknown type %q", i, p.Type)
+		}
+		if p.Position.Row < 0 || p.Position.Row >= height || p.Position.Col < 0 || p.Position.Col >= width {
+			return fmt.Errorf("powerup %d is outside the map", i)
+		}
+		if m.Tiles[p.Position.Row][p.Position.Col] != MAP_FLOOR {
+			return fmt.Errorf("powerup %d must be placed on an empty floor tile", i)
+		}
+	}
+
+	return nil
+}
+
+// CheckPlayers reports whether the map has a spawn point for every player.
+func (m *Map) CheckPlayers(maxPlayers int) error {
+	if spawns := len(m.SpawnPositions()); spawns < maxPlayers {
+		return fmt.Errorf("map %q has %d spawn points but the lobby allows %d players", m.Name, spawns, maxPlayers)
+	}
+	return nil
+}
+
+// reachableFrom flood-fills every non-wall tile reachable from start. Soft
+// blocks count as open since they can be blown up.
+func (m *Map) reachableFrom(start Position) map[Position]bool {
+	seen := map[Position]bool{start: true}
+	queue := []Position{start}
+	for len(queue) > 0 {
+		pos := queue[0]
+		queue = queue[1:]
+		for _, next := range []Position{
+			{Row: pos.Row - 1, Col: pos.Col},
+			{Row: pos.Row + 1, Col: pos.Col},
+			{Row: pos.Row, Col: pos.Col - 1},
+			{Row: pos.Row, Col: pos.Col + 1},
+		} {
+			if next.Row < 0 || next.Row >= m.Height() || next.Col < 0 || next.Col >= m.Width() {
+				continue
+			}
+			if seen[next] || m.Tiles[next.Row][next.Col] == MAP_WALL {
+				continue
+			}
+			seen[next] = true
+			queue = append(queue, next)
+		}
+	}
+	return seen
+}
+
+func (m *Map) Board() [][]int {
+	board := make([][]int, m.Height())
+	for row, line := range m.Tiles {
+		board[row] = make([]int, len(line))
+		for col := 0; col < len(line); col++ {
+			switch line[col] {
+			case MAP_WALL:
+				board[row][col] = 1
+			case MAP_SOFT:
+				board[row][col] = 2
+			}
+		}
+	}
+	return board
+}
+
+func (m *Map) SpawnPositions() []Position {
+	var spawns []Position
+	for n := byte('1'); n <= '8'; n++ {
+		for row, line := range m.Tiles {
+			for col := 0; col < len(line); col++ {
+				if line[col] == n {
+					spawns = append(spawns, Position{Row: row, Col: col})
+				}
+			}
+		}
+	}
+	return spawns
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func mapJSON(t *testing.T, m Map) string {
+	t.Helper()
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseMap(t *testing.T) {
+	arena := []string{
+		"#######",
+		"#1.+.2#",
+		"#.#.#.#",
+		"#..+..#",
+		"#.#.#.#",
+		"#3...4#",
+		"#######",
+	}
+	with := func(row int, line string) []string {
+		tiles := append([]string(nil), arena...)
+		tiles[row] = line
+		return tiles
+	}
+
+	tests := []struct {
+		name       string
+		data       string
+		wantErr    string
+		wantSpawns []Position
+	}{
+		{
+			name:       "valid",
+			data:       mapJSON(t, Map{Name: "arena", RecommendedPlayers: 4, Tiles: arena}),
+			wantSpawns: []Position{{Row: 1, Col: 1}, {Row: 1, Col: 5}, {Row: 5, Col: 1}, {Row: 5, Col: 5}},
+		},
+		{
+			name: "fixed powerup",
+			data: mapJSON(t, Map{Name: "arena", Tiles: arena, Powerups: []MapPowerup{
+				{Type: POWERUP_SHIELD, Position: Position{Row: 3, Col: 1}},
+			}}),
+			wantSpawns: []Position{{Row: 1, Col: 1}, {Row: 1, Col: 5}, {Row: 5, Col: 1}, {Row: 5, Col: 5}},
+		},
+		{name: "not json", data: "arena", wantErr: "invalid map file"},
+		{name: "no name", data: mapJSON(t, Map{Tiles: arena}), wantErr: "map name"},
+		{name: "too small", data: mapJSON(t, Map{Name: "tiny", Tiles: []string{"###", "#1#", "###"}}), wantErr: "between"},
+		{name: "ragged row", data: mapJSON(t, Map{Name: "arena", Tiles: with(3, "#..+.#")}), wantErr: "row 3 has 6 tiles"},
+		{name: "open border", data: mapJSON(t, Map{Name: "arena", Tiles: with(3, "...+..#")}), wantErr: "border is open"},
+		{name: "bad tile", data: mapJSON(t, Map{Name: "arena", Tiles: with(3, "#..?..#")}), wantErr: "invalid map tile"},
+		{name: "duplicate spawn", data: mapJSON(t, Map{Name: "arena", Tiles: with(3, "#..1..#")}), wantErr: "more than once"},
+		{name: "spawn gap", data: mapJSON(t, Map{Name: "arena", Tiles: with(5, "#3...5#")}), wantErr: "without gaps"},
+		{name: "no spawns", data: mapJSON(t, Map{Name: "arena", Tiles: []string{
+			"#####", "#...#", "#...#", "#...#", "#####",
+		}}), wantErr: "no spawn points"},
+		{name: "too many recommended", data: mapJSON(t, Map{Name: "arena", RecommendedPlayers: 5, Tiles: arena}), wantErr: "recommended player count"},
+		{name: "walled off spawn", data: mapJSON(t, Map{Name: "arena", Tiles: []string{
+			"#######", "#1.#.2#", "#..#..#", "#..#..#", "#######",
+		}}), wantErr: "spawn 2 cannot be reached"},
+		{name: "unknown powerup", data: mapJSON(t, Map{Name: "arena", Tiles: arena, Powerups: []MapPowerup{
+			{Type: "laser", Position: Position{Row: 3, Col: 3}},
+		}}), wantErr: "unknown type"},
+		{name: "powerup on wall", data: mapJSON(t, Map{Name: "arena", Tiles: arena, Powerups: []MapPowerup{
+			{Type: POWERUP_SHIELD, Position: Position{Row: 2, Col: 2}},
+		}}), wantErr: "empty floor tile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseMap([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			spawns := m.SpawnPositions()
+			if len(spawns) != len(tt.wantSpawns) {
+				t.Fatalf("got %d spawns, want %d", len(spawns), len(tt.wantSpawns))
+			}
+			for i, want := range tt.wantSpawns {
+				if spawns[i] != want {
+					t.Errorf("spawn %d at %v, want %v", i+1, spawns[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+)
+
+// PowerupType describes everything the game needs to know about one kind
+// of powerup. Adding a powerup means registering one of these; nothing else
+// in the engine switches on the type name.
+type PowerupType struct {
+	Name string
+	// Code identifies the type in the binary protocol. It must be unique.
+	Code byte
+	// Levels is how many levels the type comes in. Types with more than one
+	// level get a sprite per level, e.g. "bomb_range_2".
+	Levels int
+	// Weight is the relative chance of the type being picked for a random
+	// spawn. Zero keeps it out of random spawns.
+	Weight int
+	// MaxStacks is how many pickups of the type add up. Types that don't
+	// stack refresh their timer and keep the higher level instead.
+	MaxStacks int
+	// Combines marks types that can be held alongside anything else.
+	// Otherwise a player holds one such powerup at a time and walks over
+	// the others until it runs out.
+	Combines bool
+	Duration func(level int) time.Duration
+	Apply    func(p *Player, held *PlayerPowerup)
+	Expire   func(p *Player)
+}
+
+func (t *PowerupType) Sprite(level int) string {
+	if t.Levels > 1 {
+		return fmt.Sprintf("%s_%d", t.Name, level)
+	}
+	return t.Name
+}
+
+var powerupRegistry = make(map[string]*PowerupType)
+
+// RegisterPowerup adds t to the set of powerups games can use. It panics on
+// duplicate names or codes, since both are programming errors.
+func RegisterPowerup(t PowerupType) {
+	if _, dup := powerupRegistry[t.Name]; dup {
+		panic("powerup registered twice: " + t.Name)
+	}
+	for _, other := range powerupRegistry {
+		if other.Code == t.Code {
+			panic(fmt.Sprintf("powerup %s reuses code %d of %s", t.Name, t.Code, other.Name))
+		}
+	}
+	if t.Levels < 1 {
+		t.Levels = 1
+	}
+	if t.MaxStacks < 1 {
+		t.MaxStacks = 1
+	}
+	if t.Duration == nil {
+		t.Duration = func(int) time.Duration { return 30 * time.Second }
+	}
+	if t.Apply == nil {
+		t.Apply = func(*Player, *PlayerPowerup) {}
+	}
+	if t.Expire == nil {
+		t.Expire = func(*Player) {}
+	}
+	powerupRegistry[t.Name] = &t
+}
+
+func LookupPowerup(name string) (*PowerupType, bool) {
+	t, ok := powerupRegistry[name]
+	return t, ok
+}
+
+// PowerupTypes lists the registered types in name order.
+func PowerupTypes() []*PowerupType {
+	types := make([]*PowerupType, 0, len(powerupRegistry))
+	for _, name := range sortedKeys(powerupRegistry) {
+		types = append(types, powerupRegistry[name])
+	}
+	return types
+}
+
+func levelDuration(durations ...time.Duration) func(level int) time.Duration {
+	return func(level int) time.Duration {
+		return durations[min(max(level, 1), len(durations))-1]
+	}
+}
+
+func fixedDuration(d time.Duration) func(level int) time.Duration {
+	return func(int) time.Duration { return d }
+}
+
+const (
+	speedBoost     = 40 * time.Millisecond
+	maxExtraBombs  = 3
+	maxSpeedStacks = 2
+)
+
+// speedInterval is the move interval with the given number of speed stacks.
+func speedInterval(stacks int) time.Duration {
+	return baseMoveInterval - time.Duration(stacks)*speedBoost
+}
+
+func init() {
+	RegisterPowerup(PowerupType{
+		Name:     POWERUP_BOMB_RANGE,
+		Code:     1,
+		Levels:   2,
+		Weight:   3,
+		Duration: levelDuration(30*time.Second, 10*time.Second),
+		Apply: func(p *Player, held *PlayerPowerup) {
+			p.BombRange = 1 + held.Level
+		},
+		Expire: func(p *Player) {
+			p.BombRange = 1
+		},
+	})
+	RegisterPowerup(PowerupType{
+		Name:     POWERUP_SHIELD,
+		Code:     2,
+		Combines: true,
+		Duration: levelDuration(30*time.Second, 10*time.Second),
+		Apply: func(p *Player, held *PlayerPowerup) {
+			p.Shield = true
+		},
+		Expire: func(p *Player) {
+			p.Shield = false
+		},
+	})
+	RegisterPowerup(PowerupType{
+		Name:      POWERUP_EXTRA_BOMB,
+		Code:      3,
+		Weight:    2,
+		MaxStacks: maxExtraBombs,
+		Duration:  fixedDuration(30 * time.Second),
+		Apply: func(p *Player, held *PlayerPowerup) {
+			p.MaxBombs = 1 + held.Stacks
+		},
+		Expire: func(p *Player) {
+			p.MaxBombs = 1
+		},
+	})
+	RegisterPowerup(PowerupType{
+		Name:      POWERUP_SPEED,
+		Code:      4,
+		Weight:    2,
+		MaxStacks: maxSpeedStacks,
+		Duration:  fixedDuration(20 * time.Second),
+		Apply: func(p *Player, held *PlayerPowerup) {
+			p.MoveInterval = speedInterval(held.Stacks)
+		},
+		Expire: func(p *Player) {
+			p.MoveInterval = baseMoveInterval
+		},
+	})
+	RegisterPowerup(PowerupType{
+		Name:     POWERUP_KICK,
+		Code:     5,
+		Weight:   1,
+		Duration: fixedDuration(30 * time.Second),
+	})
+	RegisterPowerup(PowerupType{
+		Name:     POWERUP_PIERCE,
+		Code:     6,
+		Weight:   1,
+		Duration: fixedDuration(15 * time.Second),
+	})
+}
+
+func (g *Game) powerupEnabled(name string) bool {
+	if _, ok := powerupRegistry[name]; !ok {
+		return false
+	}
+	for _, disabled := range g.Rules.DisabledPowerups {
+		if disabled == name {
+			return false
+		}
+	}
+	return true
+}
+
+// randomPowerupType draws an enabled type by spawn weight, or "" if every
+// weighted type is turned off.
+func (g *Game) randomPowerupType() string {
+	total := 0
+	var candidates []*PowerupType
+	for _, t := range PowerupTypes() {
+		if t.Weight > 0 && g.powerupEnabled(t.Name) {
+			candidates = append(candidates, t)
+			total += t.Weight
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+
+	roll := g.rng.Intn(total)
+	for _, t := range candidates {
+		if roll < t.Weight {
+			return t.Name
+		}
+		roll -= t.Weight
+	}
+	return ""
+}
+
+// randomDropType draws a type for a soft-block drop, using the lobby's drop
+// weights where it set them and the registry's spawn weights otherwise.
+func (g *Game) randomDropType() string {
+	if g.Rules.DropWeights == nil {
+		return g.randomPowerupType()
+	}
+
+	total := 0
+	var candidates []string
+	for _, name := range sortedKeys(g.Rules.DropWeights) {
+		if g.Rules.DropWeights[name] > 0 && g.powerupEnabled(name) {
+			candidates = append(candidates, name)
+			total += g.Rules.DropWeights[name]
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+
+	roll := g.rng.Intn(total)
+	for _, name := range candidates {
+		if roll < g.Rules.DropWeights[name] {
+			return name
+		}
+		roll -= g.Rules.DropWeights[name]
+	}
+	return ""
+}
+
+// dropPowerup rolls for a powerup on a soft block that was just destroyed.
+// Nothing drops where a hidden powerup was already waiting.
+func (g *Game) dropPowerup(pos Position) {
+	if g.Rules.DropChance <= 0 || g.rng.Float64() >= g.Rules.DropChance {
+		return
+	}
+	for _, powerup := range g.Powerups {
+		if powerup.Position == pos {
+			return
+		}
+	}
+	powerupType := g.randomDropType()
+	if powerupType == "" {
+		return
+	}
+
+	powerup := g.newPowerup(powerupType, 1, pos)
+	powerup.Dropped = true
+	powerup.DropTick = g.Tick
+	g.Powerups[powerup.ID] = powerup
+}
+
+// burnPowerupsAt destroys dropped powerups lying in a blast. Drops from
+// this tick survive, so the blast that uncovers a drop can't also burn it.
+func (g *Game) burnPowerupsAt(pos Position) {
+	for _, powerupID := range sortedKeys(g.Powerups) {
+		powerup := g.Powerups[powerupID]
+		if powerup.Position == pos && powerup.Dropped && powerup.DropTick < g.Tick {
+			delete(g.Powerups, powerupID)
+		}
+	}
+}
+
+func (g *Game) newPowerup(powerupType string, level int, pos Position) *Powerup {
+	sprite := powerupType
+	if t, ok := powerupRegistry[powerupType]; ok {
+		level = min(max(level, 1), t.Levels)
+		sprite = t.Sprite(level)
+	}
+	return &Powerup{
+		ID:       g.nextID("powerup"),
+		Type:     powerupType,
+		Level:    level,
+		Sprite:   sprite,
+		Position: pos,
+	}
+}
+
+func (g *Game) collectPowerup(playerID string, powerupID string) {
+	powerup, exists := g.Powerups[powerupID]
+	if !exists {
+		return
+	}
+
+	player, exists := g.Players[playerID]
+	if !exists {
+		return
+	}
+
+	t, ok := powerupRegistry[powerup.Type]
+	if !ok {
+		return
+	}
+
+	if !t.Combines {
+		for heldType := range player.Powerups {
+			if other, ok := powerupRegistry[heldType]; ok && heldType != t.Name && !other.Combines {
+				return
+			}
+		}
+	}
+
+	level := powerup.Level
+	stacks := 1
+	if held, ok := player.Powerups[t.Name]; ok {
+		level = max(level, held.Level)
+		stacks = min(held.Stacks+1, t.MaxStacks)
+	}
+
+	held := &PlayerPowerup{
+		Type:    t.Name,
+		Level:   level,
+		Stacks:  stacks,
+		EndTime: g.now().Add(g.Rules.powerupDuration(t, level)),
+	}
+	player.Powerups[t.Name] = held
+	t.Apply(player, held)
+	g.stat(playerID).Pickups++
+
+	delete(g.Powerups, powerupID)
+}
+
+func (g *Game) expirePowerups(now time.Time) {
+	for _, playerID := range sortedKeys(g.Players) {
+		player := g.Players[playerID]
+		for _, powerupType := range sortedKeys(player.Powerups) {
+			if !now.Before(player.Powerups[powerupType].EndTime) {
+				g.expirePowerup(playerID, powerupType)
+			}
+		}
+	}
+}
+
+func (g *Game) expirePowerup(playerID string, powerupType string) {
+	player, exists := g.Players[playerID]
+	if !exists {
+		return
+	}
+
+	delete(player.Powerups, powerupType)
+
+	if t, ok := powerupRegistry[powerupType]; ok {
+		t.Expire(player)
+	}
+}
+
+// validatePowerupNames checks that every name refers to a registered type.
+func validatePowerupNames(names []string) error {
+	for _, name := range names {
+		if _, ok := powerupRegistry[name]; !ok {
+			return fmt.Errorf("unknown powerup type: %s", name)
+		}
+	}
+	return nil
+}
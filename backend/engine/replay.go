@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ReplayVersion is bumped whenever a change to the rules or to the record
+// layout would make older replays play out differently.
+const ReplayVersion = 6
+
+// minReplayVersion is the oldest replay ReadReplay still plays back.
+// Version 5 only differs in that the rules made configurable in version 6
+// were constants, so its rules are filled in with those constants.
+const minReplayVersion = 5
+
+const replayMagic = "SOULBOMBER-REPLAY"
+
+type ReplayPlayer struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	IsAI         bool     `json:"isAI"`
+	AIDifficulty string   `json:"aiDifficulty,omitempty"`
+	Team         int      `json:"team,omitempty"`
+	Spawn        Position `json:"spawn"`
+}
+
+type RecordedInput struct {
+	Tick int64 `json:"tick"`
+	Input
+	AI bool `json:"ai,omitempty"`
+}
+
+// Replay is everything needed to rebuild a match: the seed, rules and
+// roster it started with, plus every input it accepted and the tick it was
+// applied on.
+type Replay struct {
+	Version   int             `json:"version"`
+	GameID    string          `json:"gameId"`
+	LobbyID   string          `json:"lobbyId"`
+	Seed      int64           `json:"seed"`
+	Rules     GameRules       `json:"rules"`
+	StartTime time.Time       `json:"startTime"`
+	Ticks     int64           `json:"ticks"`
+	Players   []ReplayPlayer  `json:"players"`
+	Inputs    []RecordedInput `json:"inputs"`
+}
+
+func (g *Game) Replay() *Replay {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	players := make([]ReplayPlayer, len(g.roster))
+	copy(players, g.roster)
+	inputs := make([]RecordedInput, len(g.record))
+	copy(inputs, g.record)
+
+	return &Replay{
+		Version:   ReplayVersion,
+		GameID:    g.ID,
+		LobbyID:   g.LobbyID,
+		Seed:      g.Seed,
+		Rules:     g.Rules,
+		StartTime: g.StartTime,
+		Ticks:     g.Tick,
+		Players:   players,
+		Inputs:    inputs,
+	}
+}
+
+// NewReplayGame rebuilds the game described by r. It ignores Enqueue and
+// never runs the AI; each Step applies the inputs recorded for that tick
+// instead.
+func NewReplayGame(r *Replay, host Host) *Game {
+	g := NewGame(r.GameID, r.LobbyID, r.Seed, r.Rules, host)
+	g.StartTime = r.StartTime
+	g.replay = r.Inputs
+	if g.replay == nil {
+		g.replay = []RecordedInput{}
+	}
+	for _, p := range r.Players {
+		g.AddPlayer(Player{
+			ID:           p.ID,
+			Name:         p.Name,
+			IsAI:         p.IsAI,
+			AIDifficulty: p.AIDifficulty,
+			Team:         p.Team,
+		}, p.Spawn)
+	}
+	return g
+}
+
+func (g *Game) applyRecorded() {
+	for len(g.replay) > 0 && g.replay[0].Tick <= g.Tick {
+		g.accept(g.replay[0].Input, g.replay[0].AI)
+		g.replay = g.replay[1:]
+	}
+}
+
+// WriteReplay writes r as a magic/version header line followed by a JSON
+// body.
+func WriteReplay(w io.Writer, r *Replay) error {
+	if _, err := fmt.Fprintf(w, "%s %d\n", replayMagic, r.Version); err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(r)
+}
+
+func ReadReplay(r io.Reader) (*Replay, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading replay header: %w", err)
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(strings.TrimSpace(header), replayMagic+" %d", &version); err != nil {
+		return nil, fmt.Errorf("not a replay file")
+	}
+	if version < minReplayVersion || version > ReplayVersion {
+		return nil, fmt.Errorf("unsupported replay version %d (this server reads versions %d to %d)", version, minReplayVersion, ReplayVersion)
+	}
+
+	var replay Replay
+	if version < 6 {
+		replay.Rules = v5Rules()
+	}
+	if err := json.NewDecoder(br).Decode(&replay); err != nil {
+		return nil, fmt.Errorf("decoding replay: %w", err)
+	}
+	return &replay, nil
+}
+
+// v5Rules holds the values version 5 hardcoded for the rules version 6
+// made configurable. Decoding a version 5 body over them keeps them, since
+// its rules have no such fields.
+func v5Rules() GameRules {
+	return GameRules{
+		RoundDuration:     2 * time.Minute,
+		PowerupWaveDelay:  1 * time.Minute,
+		DashCooldown:      7 * time.Second,
+		ExplosionLifetime: 500 * time.Millisecond,
+		RespawnPenalty:    100,
+		TilePoints:        10,
+		KillPoints:        250,
+		TeamkillPenalty:   250,
+		ChainMultipliers:  []float64{1.0, 1.2, 1.6, 2.0},
+	}
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadReplayVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+		check   func(r *Replay) bool
+	}{
+		{
+			name:  "current",
+			data:  "SOULBOMBER-REPLAY 6\n{\"version\": 6, \"seed\": 9, \"rules\": {\"tilePoints\": 5}}\n",
+			check: func(r *Replay) bool { return r.Seed == 9 && r.Rules.TilePoints == 5 && r.Rules.RoundDuration == 0 },
+		},
+		{
+			name: "version 5 gets the old constants",
+			data: "SOULBOMBER-REPLAY 5\n{\"version\": 5, \"rules\": {\"tickRate\": 20}}\n",
+			check: func(r *Replay) bool {
+				return r.Rules.TickRate == 20 && r.Rules.RoundDuration == 2*time.Minute &&
+					r.Rules.TilePoints == 10 && len(r.Rules.ChainMultipliers) == 4
+			},
+		},
+		{name: "too old", data: "SOULBOMBER-REPLAY 4\n{}\n", wantErr: "version 4 (this server reads versions 5 to 6)"},
+		{name: "too new", data: "SOULBOMBER-REPLAY 7\n{}\n", wantErr: "version 7"},
+		{name: "not a replay", data: "hello\n", wantErr: "not a replay file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replay, err := ReadReplay(strings.NewReader(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(replay) {
+				t.Errorf("unexpected replay: %+v", replay)
+			}
+		})
+	}
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		seed   int64
+		ticks  int64
+		script scriptedInputs
+	}{
+		{name: "AI only", seed: 3, ticks: 400},
+		{name: "with human inputs", seed: 42, ticks: 600, script: walkAndBomb},
+		{name: "full round", seed: 7, ticks: 2500, script: walkAndBomb},
+		{name: "AI holds a seat", seed: 11, ticks: 600, script: scriptedInputs{
+			1:   {humanInput(INPUT_MOVE, "right")},
+			40:  {{Type: INPUT_AI_CONTROL, PlayerID: "human", Difficulty: AI_MEDIUM}},
+			300: {humanInput(INPUT_HUMAN_CONTROL, "")},
+			301: {humanInput(INPUT_PLACE_BOMB, "")},
+		}},
+		{name: "player leaves", seed: 12, ticks: 600, script: scriptedInputs{
+			1:  {humanInput(INPUT_MOVE, "right")},
+			40: {humanInput(INPUT_LEAVE, "")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := playScripted(t, tt.seed, tt.ticks, tt.script)
+
+			var buf bytes.Buffer
+			if err := WriteReplay(&buf, live.Replay()); err != nil {
+				t.Fatal(err)
+			}
+			replay, err := ReadReplay(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replay.Ticks != tt.ticks {
+				t.Fatalf("replay has %d ticks, want %d", replay.Ticks, tt.ticks)
+			}
+
+			replayed := NewReplayGame(replay, nil)
+			for tick := int64(0); tick < replay.Ticks; tick++ {
+				replayed.Step()
+			}
+			if !bytes.Equal(stateJSON(t, live), stateJSON(t, replayed)) {
+				t.Error("replayed game ended in a different state from the live one")
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultTickRate     = 20
+	defaultFuseDuration = 3 * time.Second
+	defaultLives        = 3
+	maxLives            = 9
+	maxTeams            = 4
+	maxPoints           = 10000
+	maxBestOf           = 9
+	maxBotDeadline      = time.Second
+	// defaultBotDeadline leaves room for a bot's round trip over a real
+	// network, and for bots not written in a fast language.
+	defaultBotDeadline = 500 * time.Millisecond
+
+	MODE_SCORE       = "score"
+	MODE_ELIMINATION = "elimination"
+
+	// MaxSpectatorDelay caps how far behind the game spectators can be put.
+	MaxSpectatorDelay = 30 * time.Second
+
+	PRESET_CLASSIC  = "classic"
+	PRESET_CHAOS    = "chaos"
+	PRESET_HARDCORE = "hardcore"
+)
+
+func DefaultGameRules() GameRules {
+	return GameRules{
+		Preset:   PRESET_CLASSIC,
+		TickRate: defaultTickRate,
+		FuseDurations: map[string]time.Duration{
+			BOMB_NORMAL: defaultFuseDuration,
+		},
+		Board:              DefaultBoardConfig(),
+		Mode:               MODE_SCORE,
+		Lives:              defaultLives,
+		SuddenDeath:        DefaultSuddenDeathConfig(),
+		BestOf:             1,
+		ReconnectGrace:     30 * time.Second,
+		BotDeadline:        defaultBotDeadline,
+		TakeoverDifficulty: AI_MEDIUM,
+		RoundDuration:      2 * time.Minute,
+		PowerupWaveDelay:   1 * time.Minute,
+		DashCooldown:       7 * time.Second,
+		ExplosionLifetime:  500 * time.Millisecond,
+		RespawnPenalty:     100,
+		TilePoints:         10,
+		KillPoints:         250,
+		TeamkillPenalty:    250,
+		ChainMultipliers:   []float64{1.0, 1.2, 1.6, 2.0},
+	}
+}
+
+// PresetRules returns the named preset. Lobbies start from a preset and
+// may override individual rules on top of it. Soft blocks only drop
+// powerups in chaos, or when a lobby sets a drop chance of its own.
+func PresetRules(name string) (GameRules, error) {
+	rules := DefaultGameRules()
+	switch name {
+	case "", PRESET_CLASSIC:
+	case PRESET_CHAOS:
+		rules.Preset = PRESET_CHAOS
+		rules.FuseDurations[BOMB_NORMAL] = 2 * time.Second
+		rules.Board.SoftDensity = 0.8
+		rules.DropChance = 0.5
+		rules.RoundDuration = 3 * time.Minute
+		rules.PowerupWaveDelay = 30 * time.Second
+		rules.DashCooldown = 3 * time.Second
+		rules.RespawnPenalty = 50
+		rules.TilePoints = 20
+		rules.KillPoints = 200
+	case PRESET_HARDCORE:
+		rules.Preset = PRESET_HARDCORE
+		rules.Mode = MODE_ELIMINATION
+		rules.Lives = 1
+		rules.FriendlyFire = true
+		rules.DisabledPowerups = []string{POWERUP_SHIELD}
+		rules.DashCooldown = 12 * time.Second
+		rules.RespawnPenalty = 200
+		rules.SuddenDeath.Enabled = true
+	default:
+		return rules, fmt.Errorf("unknown rules preset: %s", name)
+	}
+	return rules, nil
+}
+
+func validateDuration(name string, d, lo, hi time.Duration) error {
+	if d < lo || d > hi {
+		return fmt.Errorf("%s must be between %s and %s", name, lo, hi)
+	}
+	return nil
+}
+
+func validatePoints(name string, points int) error {
+	if points < 0 || points > maxPoints {
+		return fmt.Errorf("%s must be between 0 and %d", name, maxPoints)
+	}
+	return nil
+}
+
+func (r GameRules) Validate() error {
+	if r.TickRate < 5 || r.TickRate > 60 {
+		return fmt.Errorf("tick rate must be between 5 and 60")
+	}
+	for bombType, d := range r.FuseDurations {
+		if err := validateDuration(bombType+" fuse", d, 500*time.Millisecond, 10*time.Second); err != nil {
+			return err
+		}
+	}
+	if err := validateDuration("round duration", r.RoundDuration, 30*time.Second, 15*time.Minute); err != nil {
+		return err
+	}
+	if err := validateDuration("powerup wave delay", r.PowerupWaveDelay, time.Second, r.RoundDuration); err != nil {
+		return err
+	}
+	if err := validateDuration("dash cooldown", r.DashCooldown, 0, time.Minute); err != nil {
+		return err
+	}
+	if err := validateDuration("explosion lifetime", r.ExplosionLifetime, 100*time.Millisecond, 3*time.Second); err != nil {
+		return err
+	}
+	if err := validatePoints("respawn penalty", r.RespawnPenalty); err != nil {
+		return err
+	}
+	if err := validatePoints("tile points", r.TilePoints); err != nil {
+		return err
+	}
+	if err := validatePoints("kill points", r.KillPoints); err != nil {
+		return err
+	}
+	if err := validatePoints("teamkill penalty", r.TeamkillPenalty); err != nil {
+		return err
+	}
+	if len(r.ChainMultipliers) == 0 || len(r.ChainMultipliers) > 10 {
+		return fmt.Errorf("chain multipliers must have between 1 and 10 entries")
+	}
+	for _, m := range r.ChainMultipliers {
+		if m < 0 || m > 10 {
+			return fmt.Errorf("chain multipliers must be between 0 and 10")
+		}
+	}
+	for name, levels := range r.PowerupDurations {
+		if err := validatePowerupNames([]string{name}); err != nil {
+			return err
+		}
+		for _, d := range levels {
+			if err := validateDuration(name+" duration", d, time.Second, 5*time.Minute); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch r.Mode {
+	case MODE_SCORE:
+	case MODE_ELIMINATION:
+		if r.Lives < 1 || r.Lives > maxLives {
+			return fmt.Errorf("lives must be between 1 and %d", maxLives)
+		}
+	default:
+		return fmt.Errorf("invalid game mode: %s", r.Mode)
+	}
+	if r.Teams != 0 && (r.Teams < 2 || r.Teams > maxTeams) {
+		return fmt.Errorf("teams must be 0 or between 2 and %d", maxTeams)
+	}
+	if err := r.SuddenDeath.Validate(r.RoundDuration); err != nil {
+		return err
+	}
+	if err := validatePowerupNames(r.DisabledPowerups); err != nil {
+		return err
+	}
+	if r.DropChance < 0 || r.DropChance > 1 {
+		return fmt.Errorf("drop chance must be between 0 and 1")
+	}
+	for name, weight := range r.DropWeights {
+		if err := validatePowerupNames([]string{name}); err != nil {
+			return err
+		}
+		if weight < 0 {
+			return fmt.Errorf("drop weight for %s must not be negative", name)
+		}
+	}
+	if err := validateDuration("spectator delay", r.SpectatorDelay, 0, MaxSpectatorDelay); err != nil {
+		return err
+	}
+	if err := validateDuration("bot deadline", r.BotDeadline, 0, maxBotDeadline); err != nil {
+		return err
+	}
+	if err := validateDuration("reconnect grace period", r.ReconnectGrace, 0, 5*time.Minute); err != nil {
+		return err
+	}
+	if _, ok := LookupAIProfile(r.TakeoverDifficulty); !ok {
+		return fmt.Errorf("invalid takeover difficulty: %s", r.TakeoverDifficulty)
+	}
+	if r.BestOf < 1 || r.BestOf > maxBestOf || r.BestOf%2 == 0 {
+		return fmt.Errorf("best of must be an odd number between 1 and %d", maxBestOf)
+	}
+	if r.Map != nil {
+		return r.Map.Validate()
+	}
+	return r.Board.Validate()
+}
+
+func (r GameRules) elimination() bool {
+	return r.Mode == MODE_ELIMINATION
+}
+
+func (r GameRules) TeamMode() bool {
+	return r.Teams > 0
+}
+
+// RoundsToWin is how many round wins take a best-of-N match.
+func (r GameRules) RoundsToWin() int {
+	return r.BestOf/2 + 1
+}
+
+func (r GameRules) fuseDuration(bombType string) time.Duration {
+	if d, ok := r.FuseDurations[bombType]; ok && d > 0 {
+		return d
+	}
+	return defaultFuseDuration
+}
+
+// chainMultiplier scales a blast's tile points by how many soft blocks it
+// destroyed; blasts bigger than the table use its last entry.
+func (r GameRules) chainMultiplier(tiles int) float64 {
+	if tiles <= 0 || len(r.ChainMultipliers) == 0 {
+		return 1
+	}
+	return r.ChainMultipliers[min(tiles, len(r.ChainMultipliers))-1]
+}
+
+// powerupDuration is how long a powerup of type t at level lasts, using
+// the lobby's override for that level if it set one.
+func (r GameRules) powerupDuration(t *PowerupType, level int) time.Duration {
+	if levels := r.PowerupDurations[t.Name]; len(levels) > 0 {
+		return levels[min(max(level, 1), len(levels))-1]
+	}
+	return t.Duration(level)
+}
+
+func (r GameRules) TickInterval() time.Duration {
+	rate := r.TickRate
+	if rate <= 0 {
+		rate = defaultTickRate
+	}
+	return time.Second / time.Duration(rate)
+}
+
+// BotDecisionTime is how long an external bot has to answer an
+// observation: BotDeadline, or the default if that isn't set.
+func (r GameRules) BotDecisionTime() time.Duration {
+	if r.BotDeadline > 0 {
+		return r.BotDeadline
+	}
+	return defaultBotDeadline
+}
+
+// ruleDurations are the GameRules fields ApplyRulesJSON reads as durations.
+var ruleDurations = []string{
+	"spectatorDelay",
+	"botDeadline",
+	"reconnectGrace",
+	"roundDuration",
+	"powerupWaveDelay",
+	"dashCooldown",
+	"explosionLifetime",
+}
+
+var suddenDeathDurations = []string{"start", "interval", "warning"}
+
+// parseDurationJSON reads a duration written either as a string such as
+// "90s" or "500ms", or as a number of seconds.
+func parseDurationJSON(name string, raw json.RawMessage) (json.RawMessage, error) {
+	var d time.Duration
+	var text string
+	var seconds float64
+	if err := json.Unmarshal(raw, &text); err == nil {
+		parsed, err := time.ParseDuration(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		d = parsed
+	} else if err := json.Unmarshal(raw, &seconds); err == nil {
+		d = time.Duration(seconds * float64(time.Second))
+	} else {
+		return nil, fmt.Errorf("invalid %s: must be a duration string or a number of seconds", name)
+	}
+	return json.Marshal(d)
+}
+
+// normalizeDurations rewrites the named fields of a JSON object from the
+// forms parseDurationJSON accepts to what time.Duration unmarshals from.
+func normalizeDurations(fields map[string]json.RawMessage, names []string) error {
+	for _, name := range names {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		d, err := parseDurationJSON(name, raw)
+		if err != nil {
+			return err
+		}
+		fields[name] = d
+	}
+	return nil
+}
+
+// ApplySuddenDeathJSON overlays a client's sudden death settings on c,
+// reading its durations the way ApplyRulesJSON does.
+func ApplySuddenDeathJSON(c *SuddenDeathConfig, data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("invalid sudden death settings: %v", err)
+	}
+	if err := normalizeDurations(fields, suddenDeathDurations); err != nil {
+		return err
+	}
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(normalized, c)
+}
+
+// ApplyRulesJSON overlays rules a client sent on r, which should already
+// hold the lobby's preset. Durations are written as strings such as "3m"
+// or as numbers of seconds, never as raw nanoseconds. A preset named in
+// data must be the one r was built from.
+func ApplyRulesJSON(r *GameRules, data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("invalid rules: %v", err)
+	}
+
+	if raw, ok := fields["preset"]; ok {
+		var preset string
+		if err := json.Unmarshal(raw, &preset); err != nil || preset != r.Preset {
+			return fmt.Errorf("rules preset must match the lobby preset %s", r.Preset)
+		}
+	}
+	if err := normalizeDurations(fields, ruleDurations); err != nil {
+		return err
+	}
+
+	if raw, ok := fields["fuseDurations"]; ok {
+		var fuses map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fuses); err != nil {
+			return fmt.Errorf("invalid fuseDurations: %v", err)
+		}
+		if err := normalizeDurations(fuses, sortedKeys(fuses)); err != nil {
+			return err
+		}
+		fields["fuseDurations"], _ = json.Marshal(fuses)
+	}
+	if raw, ok := fields["powerupDurations"]; ok {
+		var levels map[string][]json.RawMessage
+		if err := json.Unmarshal(raw, &levels); err != nil {
+			return fmt.Errorf("invalid powerupDurations: %v", err)
+		}
+		for name, durations := range levels {
+			for i, d := range durations {
+				normalized, err := parseDurationJSON(name+" duration", d)
+				if err != nil {
+					return err
+				}
+				durations[i] = normalized
+			}
+		}
+		fields["powerupDurations"], _ = json.Marshal(levels)
+	}
+	if raw, ok := fields["suddenDeath"]; ok {
+		suddenDeath := r.SuddenDeath
+		if err := ApplySuddenDeathJSON(&suddenDeath, raw); err != nil {
+			return err
+		}
+		fields["suddenDeath"], _ = json.Marshal(suddenDeath)
+	}
+
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(normalized, r); err != nil {
+		return fmt.Errorf("invalid rules: %v", err)
+	}
+	return nil
+}
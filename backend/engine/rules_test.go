@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGameRulesValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(r *GameRules)
+		wantErr string
+	}{
+		{name: "defaults", modify: func(r *GameRules) {}},
+		{name: "elimination", modify: func(r *GameRules) { r.Mode = MODE_ELIMINATION; r.Lives = 3 }},
+		{name: "teams", modify: func(r *GameRules) { r.Teams = 2 }},
+		{name: "disable powerups", modify: func(r *GameRules) { r.DisabledPowerups = []string{POWERUP_KICK, POWERUP_PIERCE} }},
+		{name: "best of five", modify: func(r *GameRules) { r.BestOf = 5 }},
+		{name: "no reconnect grace", modify: func(r *GameRules) { r.ReconnectGrace = 0 }},
+		{name: "large board", modify: func(r *GameRules) { r.Board.Width, r.Board.Height = MaxBoardSize, MinBoardSize }},
+		{name: "even board", modify: func(r *GameRules) { r.Board.Width = 14 }, wantErr: "board width"},
+		{name: "small board", modify: func(r *GameRules) { r.Board.Height = MinBoardSize - 2 }, wantErr: "board height"},
+		{name: "soft density", modify: func(r *GameRules) { r.Board.SoftDensity = 1.5 }, wantErr: "soft block density"},
+		{name: "spawn layout", modify: func(r *GameRules) { r.Board.SpawnLayout = "random" }, wantErr: "spawn layout"},
+		{name: "tick rate", modify: func(r *GameRules) { r.TickRate = 100 }, wantErr: "tick rate"},
+		{name: "fuse", modify: func(r *GameRules) { r.FuseDurations[BOMB_NORMAL] = time.Minute }, wantErr: "normal fuse"},
+		{name: "round duration", modify: func(r *GameRules) { r.RoundDuration = time.Second }, wantErr: "round duration"},
+		{name: "wave after round", modify: func(r *GameRules) { r.PowerupWaveDelay = 3 * time.Minute }, wantErr: "powerup wave delay"},
+		{name: "negative points", modify: func(r *GameRules) { r.KillPoints = -1 }, wantErr: "kill points"},
+		{name: "no chain multipliers", modify: func(r *GameRules) { r.ChainMultipliers = nil }, wantErr: "chain multipliers"},
+		{name: "unknown powerup duration", modify: func(r *GameRules) {
+			r.PowerupDurations = map[string][]time.Duration{"laser": {time.Second}}
+		}, wantErr: "laser"},
+		{name: "mode", modify: func(r *GameRules) { r.Mode = "capture" }, wantErr: "invalid game mode"},
+		{name: "no lives", modify: func(r *GameRules) { r.Mode = MODE_ELIMINATION; r.Lives = 0 }, wantErr: "lives"},
+		{name: "one team", modify: func(r *GameRules) { r.Teams = 1 }, wantErr: "teams"},
+		{name: "sudden death after round", modify: func(r *GameRules) {
+			r.SuddenDeath.Enabled = true
+			r.SuddenDeath.Start = 5 * time.Minute
+		}, wantErr: "sudden death"},
+		{name: "disable unknown powerup", modify: func(r *GameRules) { r.DisabledPowerups = []string{"laser"} }, wantErr: "unknown powerup type"},
+		{name: "drop chance", modify: func(r *GameRules) { r.DropChance = 1.5 }, wantErr: "drop chance"},
+		{name: "negative drop weight", modify: func(r *GameRules) {
+			r.DropWeights = map[string]int{POWERUP_SPEED: -1}
+		}, wantErr: "drop weight"},
+		{name: "even best of", modify: func(r *GameRules) { r.BestOf = 2 }, wantErr: "best of"},
+		{name: "spectator delay", modify: func(r *GameRules) { r.SpectatorDelay = time.Hour }, wantErr: "spectator delay"},
+		{name: "reconnect grace", modify: func(r *GameRules) { r.ReconnectGrace = time.Hour }, wantErr: "reconnect grace period"},
+		{name: "takeover difficulty", modify: func(r *GameRules) { r.TakeoverDifficulty = "nightmare" }, wantErr: "takeover difficulty"},
+		{name: "bot deadline", modify: func(r *GameRules) { r.BotDeadline = time.Minute }, wantErr: "bot deadline"},
+		{name: "bad map", modify: func(r *GameRules) { r.Map = &Map{} }, wantErr: "map name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := DefaultGameRules()
+			tt.modify(&rules)
+			err := rules.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPresetRules(t *testing.T) {
+	for _, name := range []string{PRESET_CLASSIC, PRESET_CHAOS, PRESET_HARDCORE} {
+		t.Run(name, func(t *testing.T) {
+			rules, err := PresetRules(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := rules.Validate(); err != nil {
+				t.Errorf("preset does not validate: %v", err)
+			}
+		})
+	}
+	if _, err := PresetRules("casual"); err == nil {
+		t.Error("unknown preset was accepted")
+	}
+}
+
+func TestApplyRulesJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+		check   func(r GameRules) bool
+	}{
+		{
+			name:  "duration string",
+			data:  `{"roundDuration": "3m"}`,
+			check: func(r GameRules) bool { return r.RoundDuration == 3*time.Minute },
+		},
+		{
+			name: "seconds",
+			data: `{"roundDuration": 180, "explosionLifetime": 0.75}`,
+			check: func(r GameRules) bool {
+				return r.RoundDuration == 3*time.Minute && r.ExplosionLifetime == 750*time.Millisecond
+			},
+		},
+		{
+			name: "nested durations",
+			data: `{"fuseDurations": {"normal": "2s"}, "powerupDurations": {"speed": [10, "20s"]}, "suddenDeath": {"start": "90s"}}`,
+			check: func(r GameRules) bool {
+				return r.FuseDurations[BOMB_NORMAL] == 2*time.Second &&
+					len(r.PowerupDurations[POWERUP_SPEED]) == 2 && r.PowerupDurations[POWERUP_SPEED][1] == 20*time.Second &&
+					r.SuddenDeath.Start == 90*time.Second && r.SuddenDeath.Interval == defaultSuddenDeathInterval
+			},
+		},
+		{
+			name:  "matching preset",
+			data:  `{"preset": "classic", "tilePoints": 5}`,
+			check: func(r GameRules) bool { return r.Preset == PRESET_CLASSIC && r.TilePoints == 5 },
+		},
+		{name: "other preset", data: `{"preset": "chaos"}`, wantErr: true},
+		{name: "bad duration", data: `{"dashCooldown": "soon"}`, wantErr: true},
+		{name: "not an object", data: `[]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := DefaultGameRules()
+			err := ApplyRulesJSON(&rules, []byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(rules) {
+				t.Errorf("rules not applied: %+v", rules)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package engine
+
+// PlayerStats counts what a player did during a round. They are kept out
+// of the broadcast state; hosts read them with Stats.
+type PlayerStats struct {
+	TilesDestroyed int `json:"tilesDestroyed"`
+	Kills          int `json:"kills"`
+	TeamKills      int `json:"teamKills"`
+	Deaths         int `json:"deaths"`
+	Pickups        int `json:"pickups"`
+}
+
+func (g *Game) stat(playerID string) *PlayerStats {
+	s, ok := g.stats[playerID]
+	if !ok {
+		s = &PlayerStats{}
+		g.stats[playerID] = s
+	}
+	return s
+}
+
+// Stats returns a copy of every player's stats so far.
+func (g *Game) Stats() map[string]PlayerStats {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	stats := make(map[string]PlayerStats, len(g.stats))
+	for id, s := range g.stats {
+		stats[id] = *s
+	}
+	return stats
+}
@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultSuddenDeathStart    = 90 * time.Second
+	defaultSuddenDeathInterval = 250 * time.Millisecond
+	defaultSuddenDeathWarning  = 2 * time.Second
+)
+
+// SuddenDeathConfig schedules the closing walls. Start is measured from the
+// beginning of the round; after that one wall drops every Interval, and each
+// one is announced Warning ahead of time. While sudden death is enabled the
+// round no longer ends on the clock, only when one side is left or the
+// spiral is complete.
+type SuddenDeathConfig struct {
+	Enabled  bool          `json:"enabled"`
+	Start    time.Duration `json:"start"`
+	Interval time.Duration `json:"interval"`
+	Warning  time.Duration `json:"warning"`
+}
+
+func DefaultSuddenDeathConfig() SuddenDeathConfig {
+	return SuddenDeathConfig{
+		Start:    defaultSuddenDeathStart,
+		Interval: defaultSuddenDeathInterval,
+		Warning:  defaultSuddenDeathWarning,
+	}
+}
+
+func (c SuddenDeathConfig) Validate(roundDuration time.Duration) error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Start < 10*time.Second || c.Start > roundDuration {
+		return fmt.Errorf("sudden death must start between 10s and %s", roundDuration)
+	}
+	if c.Interval < 50*time.Millisecond || c.Interval > 10*time.Second {
+		return fmt.Errorf("sudden death interval must be between 50ms and 10s")
+	}
+	if c.Warning < 0 || c.Warning > 10*time.Second {
+		return fmt.Errorf("sudden death warning must be between 0s and 10s")
+	}
+	return nil
+}
+
+// spiralOrder lists every cell inside the border, ring by ring from the
+// outside in, walking each ring clockwise from its top-left corner.
+func spiralOrder(height, width int) []Position {
+	var cells []Position
+	top, left, bottom, right := 1, 1, height-2, width-2
+	for top <= bottom && left <= right {
+		for col := left; col <= right; col++ {
+			cells = append(cells, Position{Row: top, Col: col})
+		}
+		for row := top + 1; row <= bottom; row++ {
+			cells = append(cells, Position{Row: row, Col: right})
+		}
+		if top < bottom {
+			for col := right - 1; col >= left; col-- {
+				cells = append(cells, Position{Row: bottom, Col: col})
+			}
+		}
+		if left < right {
+			for row := bottom - 1; row > top; row-- {
+				cells = append(cells, Position{Row: row, Col: left})
+			}
+		}
+		top, left, bottom, right = top+1, left+1, bottom-1, right-1
+	}
+	return cells
+}
+
+func (g *Game) suddenDeathStarted() bool {
+	config := g.Rules.SuddenDeath
+	return config.Enabled && !g.now().Before(g.StartTime.Add(config.Start))
+}
+
+// advanceSuddenDeath announces and drops the walls that are due by now. The
+// spiral is fixed one warning period before the phase starts, so the first
+// wall gets a full warning too; cells that are already walls by then are
+// skipped, so every scheduled drop changes the board.
+func (g *Game) advanceSuddenDeath(now time.Time) {
+	config := g.Rules.SuddenDeath
+	if !config.Enabled || now.Before(g.StartTime.Add(config.Start-config.Warning)) {
+		return
+	}
+
+	if g.suddenDeath == nil {
+		g.suddenDeath = []Position{}
+		for _, pos := range spiralOrder(len(g.Board), len(g.Board[0])) {
+			if g.Board[pos.Row][pos.Col] != 1 {
+				g.suddenDeath = append(g.suddenDeath, pos)
+			}
+		}
+		g.events = append(g.events, Event{Type: "suddenDeath", Payload: map[string]interface{}{
+			"start":    g.StartTime.Add(config.Start),
+			"interval": config.Interval.Milliseconds(),
+			"warning":  config.Warning.Milliseconds(),
+			"walls":    len(g.suddenDeath),
+		}})
+	}
+
+	var warnings []map[string]interface{}
+	for g.wallsWarned < len(g.suddenDeath) {
+		at := g.wallDropTime(g.wallsWarned)
+		if now.Before(at.Add(-config.Warning)) {
+			break
+		}
+		warnings = append(warnings, map[string]interface{}{
+			"position": g.suddenDeath[g.wallsWarned],
+			"at":       at,
+		})
+		g.wallsWarned++
+	}
+	if len(warnings) > 0 {
+		g.events = append(g.events, Event{Type: "wallWarning", Payload: warnings})
+	}
+
+	for g.wallsDropped < len(g.suddenDeath) && !now.Before(g.wallDropTime(g.wallsDropped)) {
+		g.dropWall(g.suddenDeath[g.wallsDropped])
+		g.wallsDropped++
+	}
+}
+
+func (g *Game) wallDropTime(index int) time.Time {
+	config := g.Rules.SuddenDeath
+	return g.StartTime.Add(config.Start + time.Duration(index)*config.Interval)
+}
+
+func (g *Game) suddenDeathComplete() bool {
+	return g.suddenDeathStarted() && g.wallsDropped >= len(g.suddenDeath)
+}
+
+// dropWall turns pos into an indestructible wall, crushing anything on it.
+// Shields and lives don't help against a wall.
+func (g *Game) dropWall(pos Position) {
+	g.Board[pos.Row][pos.Col] = 1
+
+	for _, bombID := range sortedKeys(g.Bombs) {
+		if g.Bombs[bombID].Position == pos {
+			delete(g.Bombs, bombID)
+		}
+	}
+	for _, powerupID := range sortedKeys(g.Powerups) {
+		if g.Powerups[powerupID].Position == pos {
+			delete(g.Powerups, powerupID)
+		}
+	}
+	for _, playerID := range sortedKeys(g.Players) {
+		player := g.Players[playerID]
+		if player.Alive && player.Position == pos {
+			g.stat(player.ID).Deaths++
+			g.eliminatePlayer(player)
+		}
+	}
+
+	g.events = append(g.events, Event{Type: "wallDrop", Payload: pos})
+}
@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	AI_EASY       = "easy"
+	AI_MEDIUM     = "medium"
+	AI_HARD       = "hard"
+	AI_CHOSEN_ONE = "chosen_one"
+
+	AI_CAMPER = "camper"
+	AI_HUNTER = "hunter"
+	AI_FARMER = "farmer"
+)
+
+type Position struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+type Player struct {
+	ID            string                    `json:"id"`
+	Name          string                    `json:"name"`
+	Position      Position                  `json:"position"`
+	SpawnPosition Position                  `json:"spawnPosition"`
+	Alive         bool                      `json:"alive"`
+	BombCount     int                       `json:"bombCount"`
+	MaxBombs      int                       `json:"maxBombs"`
+	BombRange     int                       `json:"bombRange"`
+	IsAI          bool                      `json:"isAI"`
+	AIDifficulty  string                    `json:"aiDifficulty"`
+	BotID         string                    `json:"botId,omitempty"`
+	Slot          int                       `json:"slot"`
+	Score         int                       `json:"score"`
+	Powerups      map[string]*PlayerPowerup `json:"powerups"`
+	Shield        bool                      `json:"shield"`
+	Lives         int                       `json:"lives"`
+	Spectator     bool                      `json:"spectator"`
+	Team          int                       `json:"team"`
+	LastDash      time.Time                 `json:"lastDash,omitempty"`
+	MoveInterval  time.Duration             `json:"moveInterval"`
+	LastMove      time.Time                 `json:"-"`
+}
+
+type Game struct {
+	ID           string                  `json:"id"`
+	LobbyID      string                  `json:"lobbyId"`
+	Board        [][]int                 `json:"board"`
+	Players      map[string]*Player      `json:"players"`
+	Bombs        map[string]*Bomb        `json:"bombs"`
+	Explosions   map[string]*Explosion   `json:"explosions"`
+	Powerups     map[string]*Powerup     `json:"powerups"`
+	Status       string                  `json:"status"`
+	StartTime    time.Time               `json:"startTime"`
+	EndTime      time.Time               `json:"endTime"`
+	Winner       string                  `json:"winner"`
+	TeamScores   map[int]int             `json:"teamScores,omitempty"`
+	Tick         int64                   `json:"tick"`
+	Seed         int64                   `json:"seed"`
+	Rules        GameRules               `json:"-"`
+	host         Host                    `json:"-"`
+	rng          *rand.Rand              `json:"-"`
+	aiRng        *rand.Rand              `json:"-"`
+	roster       []ReplayPlayer          `json:"-"`
+	record       []RecordedInput         `json:"-"`
+	replay       []RecordedInput         `json:"-"`
+	mu           sync.RWMutex            `json:"-"`
+	inputs       []Input                 `json:"-"`
+	inputMu      sync.Mutex              `json:"-"`
+	detonations  []string                `json:"-"`
+	events       []Event                 `json:"-"`
+	nextAIMove   map[string]time.Time    `json:"-"`
+	stats        map[string]*PlayerStats `json:"-"`
+	seq          int                     `json:"-"`
+	powerupWave  bool                    `json:"-"`
+	suddenDeath  []Position              `json:"-"`
+	wallsWarned  int                     `json:"-"`
+	wallsDropped int                     `json:"-"`
+	stop         chan struct{}           `json:"-"`
+	stopOnce     sync.Once               `json:"-"`
+}
+
+// Event is a message the game wants delivered to everyone watching it, in
+// addition to the per-tick state.
+type Event struct {
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+}
+
+const (
+	INPUT_MOVE            = "move"
+	INPUT_PLACE_BOMB      = "placeBomb"
+	INPUT_DASH            = "dash"
+	INPUT_REMOTE_DETONATE = "remoteDetonate"
+	INPUT_LEAVE           = "leave"
+	INPUT_AI_CONTROL      = "aiControl"
+	INPUT_HUMAN_CONTROL   = "humanControl"
+)
+
+type Input struct {
+	Type       string `json:"type"`
+	PlayerID   string `json:"playerId"`
+	Direction  string `json:"direction,omitempty"`
+	Difficulty string `json:"difficulty,omitempty"`
+}
+
+type inputError struct {
+	PlayerID string
+	Err      error
+}
+
+const (
+	BOMB_NORMAL = "normal"
+)
+
+type GameRules struct {
+	Preset           string                   `json:"preset"`
+	TickRate         int                      `json:"tickRate"`
+	FuseDurations    map[string]time.Duration `json:"fuseDurations"`
+	Board            BoardConfig              `json:"board"`
+	Map              *Map                     `json:"map,omitempty"`
+	Mode             string                   `json:"mode"`
+	Lives            int                      `json:"lives"`
+	Teams            int                      `json:"teams"`
+	FriendlyFire     bool                     `json:"friendlyFire"`
+	SuddenDeath      SuddenDeathConfig        `json:"suddenDeath"`
+	DisabledPowerups []string                 `json:"disabledPowerups,omitempty"`
+	DropChance       float64                  `json:"dropChance"`
+	DropWeights      map[string]int           `json:"dropWeights,omitempty"`
+	BestOf           int                      `json:"bestOf"`
+	SpectatorDelay   time.Duration            `json:"spectatorDelay"`
+	BotDeadline      time.Duration            `json:"botDeadline"`
+
+	ReconnectGrace     time.Duration `json:"reconnectGrace"`
+	ReplaceWithAI      bool          `json:"replaceWithAI"`
+	AITakeover         bool          `json:"aiTakeover"`
+	TakeoverDifficulty string        `json:"takeoverDifficulty"`
+
+	RoundDuration     time.Duration              `json:"roundDuration"`
+	PowerupWaveDelay  time.Duration              `json:"powerupWaveDelay"`
+	DashCooldown      time.Duration              `json:"dashCooldown"`
+	ExplosionLifetime time.Duration              `json:"explosionLifetime"`
+	PowerupDurations  map[string][]time.Duration `json:"powerupDurations,omitempty"`
+	RespawnPenalty    int                        `json:"respawnPenalty"`
+	TilePoints        int                        `json:"tilePoints"`
+	KillPoints        int                        `json:"killPoints"`
+	TeamkillPenalty   int                        `json:"teamkillPenalty"`
+	ChainMultipliers  []float64                  `json:"chainMultipliers"`
+}
+
+type Bomb struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	PlayerID string    `json:"playerId"`
+	Position Position  `json:"position"`
+	Range    int       `json:"range"`
+	PlacedAt time.Time `json:"placedAt"`
+	FuseEnd  time.Time `json:"fuseEnd"`
+	Pierce   bool      `json:"pierce,omitempty"`
+	Sliding  string    `json:"sliding,omitempty"`
+}
+
+type Explosion struct {
+	ID       string    `json:"id"`
+	Position Position  `json:"position"`
+	EndTime  time.Time `json:"endTime"`
+}
+
+type ChainExplosion struct {
+	OriginalBombID string
+	PlayerID       string
+	TilesDestroyed int
+	PlayersKilled  int
+	TeamKills      int
+}
+
+const (
+	POWERUP_BOMB_RANGE = "bomb_range"
+	POWERUP_SHIELD     = "shield"
+	POWERUP_EXTRA_BOMB = "extra_bomb"
+	POWERUP_SPEED      = "speed"
+	POWERUP_KICK       = "kick"
+	POWERUP_PIERCE     = "pierce"
+)
+
+type Powerup struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Level    int       `json:"level"`
+	Sprite   string    `json:"sprite"`
+	Position Position  `json:"position"`
+	EndTime  time.Time `json:"endTime"`
+	Dropped  bool      `json:"dropped,omitempty"`
+	DropTick int64     `json:"-"`
+}
+
+type PlayerPowerup struct {
+	Type    string    `json:"type"`
+	Level   int       `json:"level"`
+	Stacks  int       `json:"stacks"`
+	EndTime time.Time `json:"endTime"`
+}
@@ -4,16 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"math/rand"
 	"time"
+
+	"soulbomber-backend/engine"
 )
 
+const lobbyMaxPlayers = 4
+
 var (
 	lobbyCleanupRunning bool
 )
 
-const boardSize = 15
-
 func startLobbyCleanup() {
 	if lobbyCleanupRunning {
 		return
@@ -91,20 +92,21 @@ func cleanupEmptyLobbies() {
 	}
 }
 
-func getActivePlayersInLobby(lobbyID string) []Player {
+func getActivePlayersInLobby(lobbyID string) []engine.Player {
 	if playerTracker == nil {
-		return []Player{}
+		return []engine.Player{}
 	}
 
 	sessions := playerTracker.GetLobbyPlayers(lobbyID)
-	var activePlayers []Player
+	var activePlayers []engine.Player
 
 	for _, session := range sessions {
 		if session.Status == "active" {
-			player := Player{
+			player := engine.Player{
 				ID:   session.PlayerID,
 				Name: session.PlayerName,
 				IsAI: session.IsAI,
+				Team: session.Team,
 			}
 			activePlayers = append(activePlayers, player)
 		}
@@ -123,7 +125,7 @@ func updateLobbyPlayerCount(lobbyID string, playerCount int) error {
 	return err
 }
 
-func createLobby(name string, isSinglePlayer bool, aiPlayers []AIPlayer) (*Lobby, error) {
+func createLobby(name string, isSinglePlayer bool, aiPlayers []AIPlayer, rules engine.GameRules, mapID string) (*Lobby, error) {
 	id := newUUID()
 	now := time.Now()
 
@@ -132,24 +134,36 @@ func createLobby(name string, isSinglePlayer bool, aiPlayers []AIPlayer) (*Lobby
 		return nil, err
 	}
 
+	rulesJSON, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+
 	_, err = db.Exec(`
-		INSERT INTO lobbies (id, name, player_count, max_players, status, created_at, is_single_player, ai_players)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, id, name, 0, 4, "waiting", now, isSinglePlayer, aiPlayersJSON)
+		INSERT INTO lobbies (id, name, player_count, max_players, status, created_at, is_single_player, ai_players, rules, map_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, name, 0, lobbyMaxPlayers, "waiting", now, isSinglePlayer, aiPlayersJSON, rulesJSON, mapID)
 
 	if err != nil {
 		return nil, err
 	}
+	for _, ai := range aiPlayers {
+		if err := addAIToLobby(id, ai.Difficulty, ""); err != nil {
+			return nil, err
+		}
+	}
 
 	lobby := &Lobby{
 		ID:             id,
 		Name:           name,
 		PlayerCount:    0,
-		MaxPlayers:     4,
+		MaxPlayers:     lobbyMaxPlayers,
 		Status:         "waiting",
 		CreatedAt:      now,
 		IsSinglePlayer: isSinglePlayer,
 		AIPlayers:      aiPlayers,
+		Rules:          rules,
+		MapID:          mapID,
 	}
 
 	return lobby, nil
@@ -157,7 +171,7 @@ func createLobby(name string, isSinglePlayer bool, aiPlayers []AIPlayer) (*Lobby
 
 func getLobbies() []Lobby {
 	rows, err := db.Query(`
-		SELECT id, name, player_count, max_players, status, created_at, is_single_player, ai_players
+		SELECT id, name, player_count, max_players, status, created_at, is_single_player, ai_players, rules, map_id
 		FROM lobbies
 		WHERE status = 'waiting'
 		ORDER BY created_at DESC
@@ -171,7 +185,7 @@ func getLobbies() []Lobby {
 	var lobbies []Lobby
 	for rows.Next() {
 		var lobby Lobby
-		var aiPlayersJSON string
+		var aiPlayersJSON, rulesJSON string
 		err := rows.Scan(
 			&lobby.ID,
 			&lobby.Name,
@@ -181,6 +195,8 @@ func getLobbies() []Lobby {
 			&lobby.CreatedAt,
 			&lobby.IsSinglePlayer,
 			&aiPlayersJSON,
+			&rulesJSON,
+			&lobby.MapID,
 		)
 		if err != nil {
 			log.Printf("Error scanning lobby: %v", err)
@@ -190,6 +206,12 @@ func getLobbies() []Lobby {
 		if aiPlayersJSON != "" {
 			json.Unmarshal([]byte(aiPlayersJSON), &lobby.AIPlayers)
 		}
+		lobby.Rules, err = decodeLobbyRules(rulesJSON)
+		if err != nil {
+			logError("Invalid stored lobby rules, hiding the lobby", err, "lobbyID", lobby.ID)
+			continue
+		}
+		lobby.Spectators = hub.spectatorCount(lobby.ID)
 
 		lobbies = append(lobbies, lobby)
 	}
@@ -197,12 +219,12 @@ func getLobbies() []Lobby {
 	return lobbies
 }
 
-func getLobbyWithPlayers(lobbyID string) (*Lobby, []Player, bool) {
+func getLobbyWithPlayers(lobbyID string) (*Lobby, []engine.Player, bool) {
 	var lobby Lobby
-	var aiPlayersJSON string
+	var aiPlayersJSON, rulesJSON string
 
 	err := db.QueryRow(`
-		SELECT id, name, player_count, max_players, status, created_at, is_single_player, ai_players
+		SELECT id, name, player_count, max_players, status, created_at, is_single_player, ai_players, rules, map_id
 		FROM lobbies
 		WHERE id = ?
 	`, lobbyID).Scan(
@@ -214,6 +236,8 @@ func getLobbyWithPlayers(lobbyID string) (*Lobby, []Player, bool) {
 		&lobby.CreatedAt,
 		&lobby.IsSinglePlayer,
 		&aiPlayersJSON,
+		&rulesJSON,
+		&lobby.MapID,
 	)
 
 	if err != nil {
@@ -223,117 +247,235 @@ func getLobbyWithPlayers(lobbyID string) (*Lobby, []Player, bool) {
 	if aiPlayersJSON != "" {
 		json.Unmarshal([]byte(aiPlayersJSON), &lobby.AIPlayers)
 	}
+	lobby.Rules, err = decodeLobbyRules(rulesJSON)
+	if err != nil {
+		logError("Invalid stored lobby rules, rejecting the lobby", err, "lobbyID", lobbyID)
+		return nil, nil, false
+	}
+	lobby.Spectators = hub.spectatorCount(lobbyID)
 
 	players := getPlayersForLobby(lobbyID)
 
 	return &lobby, players, true
 }
 
-func getPlayersForLobby(lobbyID string) []Player {
+// decodeLobbyRules overlays the stored rules on the defaults, so lobbies
+// saved before a setting existed still get a playable value for it. Rules
+// that can't be read are an error rather than a quiet switch to the
+// defaults, which would hand players a different game than they chose.
+func decodeLobbyRules(rulesJSON string) (engine.GameRules, error) {
+	rules := engine.DefaultGameRules()
+	if rulesJSON == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+		return rules, err
+	}
+	if err := rules.Validate(); err != nil {
+		return rules, err
+	}
+	return rules, nil
+}
+
+// getLobbyRules returns the rules a new game in the lobby should use,
+// including the lobby's map if it chose one.
+func getLobbyRules(lobbyID string) (engine.GameRules, error) {
+	var rulesJSON, mapID string
+	err := db.QueryRow(`SELECT rules, map_id FROM lobbies WHERE id = ?`, lobbyID).Scan(&rulesJSON, &mapID)
+	if err != nil {
+		return engine.GameRules{}, fmt.Errorf("failed to load lobby rules: %v", err)
+	}
+
+	rules, err := decodeLobbyRules(rulesJSON)
+	if err != nil {
+		return rules, fmt.Errorf("invalid lobby rules: %v", err)
+	}
+	if mapID != "" {
+		m, err := getMap(mapID)
+		if err != nil {
+			logError("Failed to load lobby map, generating a board instead", err, "lobbyID", lobbyID, "mapID", mapID)
+			return rules, nil
+		}
+		rules.Map = m
+	}
+	return rules, nil
+}
+
+func getPlayersForLobby(lobbyID string) []engine.Player {
 	if playerTracker == nil {
-		return []Player{}
+		return []engine.Player{}
 	}
 
 	sessions := playerTracker.GetLobbyPlayers(lobbyID)
-	var players []Player
+	var players []engine.Player
 
 	for _, session := range sessions {
-		player := Player{
-			ID:   session.PlayerID,
-			Name: session.PlayerName,
-			IsAI: session.IsAI,
+		player := engine.Player{
+			ID:    session.PlayerID,
+			Name:  session.PlayerName,
+			IsAI:  session.IsAI,
+			BotID: session.BotID,
+			Team:  session.Team,
 		}
 		players = append(players, player)
 	}
 
-	return players
+	return append(players, getAISlots(lobbyID)...)
 }
 
-func getSpawnPositions() []Position {
-	s := 2
-	l := boardSize - 3
-	return []Position{
-		{Row: s, Col: s},
-		{Row: s, Col: l},
-		{Row: l, Col: s},
-		{Row: l, Col: l},
+// getAISlots returns the AI players added to a lobby. A slot with a local
+// bot is played by that bot's process instead of the built-in AI.
+func getAISlots(lobbyID string) []engine.Player {
+	rows, err := db.Query(`
+		SELECT id, name, ai_difficulty, local_bot
+		FROM players
+		WHERE lobby_id = ? AND is_ai = true
+		ORDER BY rowid
+	`, lobbyID)
+	if err != nil {
+		logError("Failed to load AI slots", err, "lobbyID", lobbyID)
+		return nil
+	}
+	defer rows.Close()
+
+	var players []engine.Player
+	for rows.Next() {
+		var p engine.Player
+		var localBot string
+		if err := rows.Scan(&p.ID, &p.Name, &p.AIDifficulty, &localBot); err != nil {
+			logError("Failed to scan AI slot", err, "lobbyID", lobbyID)
+			continue
+		}
+		if localBot != "" {
+			p.BotID = localBotPrefix + localBot
+			p.AIDifficulty = ""
+		} else {
+			p.IsAI = true
+		}
+		players = append(players, p)
 	}
+	return players
 }
 
-func initializePlayers(game *Game, players []Player, joiningPlayerID string) {
-	spawnPositions := getSpawnPositions()
-	playerIndex := 0
+// initializePlayers adds everyone to game. startGameInternal has already
+// checked there is a spawn for each of them.
+func initializePlayers(game *engine.Game, players []engine.Player, joiningPlayerID string) {
+	if !containsPlayer(players, joiningPlayerID) {
+		player := engine.Player{ID: joiningPlayerID, Name: "Player"}
+		if playerTracker != nil {
+			if session := playerTracker.GetPlayerSession(joiningPlayerID); session != nil {
+				player.Name = session.PlayerName
+				player.BotID = session.BotID
+				player.Team = session.Team
+			}
+		}
+		players = append(players, player)
+	}
+
+	spawnPositions := game.SpawnPositions()
+	teamSpawns := game.TeamSpawnPositions()
+	teamIndex := make(map[int]int)
+
+	for playerIndex, p := range players {
+		if game.Rules.AITakeover && !p.IsAI && playerTracker != nil {
+			if session := playerTracker.GetPlayerSession(p.ID); session != nil && session.Status == "disconnected" {
+				p.IsAI = true
+				p.AIDifficulty = game.Rules.TakeoverDifficulty
+			}
+		}
+		spawn := spawnPositions[playerIndex]
+		if game.Rules.TeamMode() && p.Team > 0 && p.Team <= len(teamSpawns) && len(teamSpawns[p.Team-1]) > 0 {
+			group := teamSpawns[p.Team-1]
+			spawn = group[teamIndex[p.Team]%len(group)]
+			teamIndex[p.Team]++
+		}
+		game.AddPlayer(p, spawn)
+	}
+}
 
+func containsPlayer(players []engine.Player, playerID string) bool {
 	for _, p := range players {
-		pc := p
-		pc.Alive = true
-		pc.BombCount = 0
-		pc.MaxBombs = 1
-		pc.BombRange = 1
-		pc.Score = 0
-		pc.Powerups = make(map[string]*PlayerPowerup)
-		pos := spawnPositions[playerIndex%4]
-		pc.Position = pos
-		pc.SpawnPosition = pos
-		game.Players[pc.ID] = &pc
-		if pc.IsAI {
-			game.startAITicker(pc.ID)
+		if p.ID == playerID {
+			return true
 		}
-		playerIndex++
 	}
+	return false
+}
 
-	if _, exists := game.Players[joiningPlayerID]; !exists {
-		playerName := "Player"
-		if playerTracker != nil {
-			if session := playerTracker.GetPlayerSession(joiningPlayerID); session != nil {
-				playerName = session.PlayerName
-			}
+// assignTeam puts a player who has no team yet on the smallest team in the
+// lobby, lowest team number first.
+func assignTeam(lobbyID, playerID string) {
+	if playerTracker == nil {
+		return
+	}
+	rules, err := getLobbyRules(lobbyID)
+	if err != nil {
+		logError("Failed to assign team", err, "lobbyID", lobbyID, "playerID", playerID)
+		return
+	}
+	if !rules.TeamMode() {
+		return
+	}
+	session := playerTracker.GetPlayerSession(playerID)
+	if session == nil || (session.Team > 0 && session.Team <= rules.Teams) {
+		return
+	}
+
+	counts := make([]int, rules.Teams+1)
+	for _, s := range playerTracker.GetLobbyPlayers(lobbyID) {
+		if s.PlayerID != playerID && s.Team > 0 && s.Team <= rules.Teams {
+			counts[s.Team]++
 		}
-		spawnPos := spawnPositions[playerIndex%4]
-		p := &Player{
-			ID:            joiningPlayerID,
-			Name:          playerName,
-			Position:      spawnPos,
-			SpawnPosition: spawnPos,
-			Alive:         true,
-			BombCount:     0,
-			MaxBombs:      1,
-			BombRange:     1,
-			IsAI:          false,
-			Score:         0,
-			Powerups:      make(map[string]*PlayerPowerup),
+	}
+	team := 1
+	for t := 2; t <= rules.Teams; t++ {
+		if counts[t] < counts[team] {
+			team = t
 		}
-		game.Players[joiningPlayerID] = p
 	}
+	playerTracker.SetPlayerTeam(playerID, team)
 }
 
-func startGameInternal(lobbyID, joiningPlayerID string, players []Player) (*Game, error) {
+func startGameInternal(lobbyID, joiningPlayerID string, players []engine.Player) (*engine.Game, error) {
+	rules, err := getLobbyRules(lobbyID)
+	if err != nil {
+		return nil, err
+	}
+	game := engine.NewGame(newUUID(), lobbyID, newSeed(), rules, gameHost{})
+
+	seats := len(players)
+	if !containsPlayer(players, joiningPlayerID) {
+		seats++
+	}
+	if spawns := len(game.SpawnPositions()); seats > spawns {
+		return nil, fmt.Errorf("too many players: the board only has %d spawns", spawns)
+	}
+
 	gamesMu.Lock()
+	var stale []*engine.Game
 	for gameID, game := range games {
 		if game.LobbyID == lobbyID {
+			stale = append(stale, game)
 			delete(games, gameID)
 		}
 	}
 	gamesMu.Unlock()
+	for _, game := range stale {
+		game.Stop()
+		stopLocalBots(game.ID)
+		dropBotTallies(game.ID)
+	}
+	dropStateStream(lobbyID)
 
-	gameID := newUUID()
-	game := &Game{
-		ID:         gameID,
-		LobbyID:    lobbyID,
-		Board:      generateBoard(),
-		Players:    make(map[string]*Player),
-		Bombs:      make(map[string]*Bomb),
-		Explosions: make(map[string]*Explosion),
-		Powerups:   generatePowerups(1),
-		Status:     "playing",
-		StartTime:  time.Now(),
-		aiTickers:  make(map[string]*time.Ticker),
-	}
-
-	_, err := db.Exec(`
-		INSERT INTO games (id, lobby_id, status, start_time, board)
-		VALUES (?, ?, ?, ?, ?)
-	`, gameID, lobbyID, "playing", game.StartTime, "[]")
+	matchID, err := beginRound(lobbyID, game.ID, game.Rules, joiningPlayerID, players)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO games (id, lobby_id, status, start_time, board, seed, match_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, game.ID, lobbyID, "playing", game.StartTime, "[]", game.Seed, matchID)
 	if err != nil {
 		return nil, err
 	}
@@ -349,9 +491,12 @@ func startGameInternal(lobbyID, joiningPlayerID string, players []Player) (*Game
 
 	initializePlayers(game, players, joiningPlayerID)
 
-	games[gameID] = game
+	gamesMu.Lock()
+	games[game.ID] = game
+	gamesMu.Unlock()
 
-	game.startGameTimers()
+	startLocalBots(game)
+	game.Start()
 
 	return game, nil
 }
@@ -363,8 +508,7 @@ func joinLobby(lobbyID, playerID string) error {
 
 	playerTracker.UpdatePlayerStatus(playerID, "active")
 
-	sessions := playerTracker.GetLobbyPlayers(lobbyID)
-	playerCount := len(sessions)
+	playerCount := lobbyPlayerCount(lobbyID)
 
 	var maxPlayers int
 	err := db.QueryRow(`SELECT max_players FROM lobbies WHERE id = ?`, lobbyID).Scan(&maxPlayers)
@@ -398,8 +542,7 @@ func joinLobbyWithName(lobbyID, playerID, playerName string) error {
 		return fmt.Errorf("lobby not found")
 	}
 
-	sessions := playerTracker.GetLobbyPlayers(lobbyID)
-	playerCount := len(sessions)
+	playerCount := lobbyPlayerCount(lobbyID)
 
 	var maxPlayers int
 	err := db.QueryRow(`SELECT max_players FROM lobbies WHERE id = ?`, lobbyID).Scan(&maxPlayers)
@@ -420,7 +563,7 @@ func joinLobbyWithName(lobbyID, playerID, playerName string) error {
 	return nil
 }
 
-func startSinglePlayerGame(lobbyID, playerID string) (*Game, error) {
+func startSinglePlayerGame(lobbyID, playerID string) (*engine.Game, error) {
 	_, players, exists := getLobbyWithPlayers(lobbyID)
 	if !exists {
 		return nil, fmt.Errorf("lobby not found")
@@ -428,7 +571,7 @@ func startSinglePlayerGame(lobbyID, playerID string) (*Game, error) {
 	return startGameInternal(lobbyID, playerID, players)
 }
 
-func startGame(lobbyID, playerID string) (*Game, error) {
+func startGame(lobbyID, playerID string) (*engine.Game, error) {
 	players := getPlayersForLobby(lobbyID)
 	if len(players) == 0 {
 		return nil, fmt.Errorf("no players in lobby")
@@ -436,89 +579,6 @@ func startGame(lobbyID, playerID string) (*Game, error) {
 	return startGameInternal(lobbyID, playerID, players)
 }
 
-func generateBoard() [][]int {
-	board := make([][]int, 15)
-	for i := range board {
-		board[i] = make([]int, 15)
-	}
-
-	for i := 0; i < 15; i++ {
-		for j := 0; j < 15; j++ {
-			if i == 0 || i == 14 || j == 0 || j == 14 {
-				board[i][j] = 1
-			} else if i%2 == 0 && j%2 == 0 {
-				board[i][j] = 1
-			} else if rand.Float64() < 0.6 {
-				board[i][j] = 2
-			}
-		}
-	}
-
-	board[1][1] = 0
-	board[1][2] = 0
-	board[2][1] = 0
-
-	board[1][12] = 0
-	board[1][13] = 0
-	board[2][13] = 0
-
-	board[12][1] = 0
-	board[13][1] = 0
-	board[13][2] = 0
-
-	board[12][13] = 0
-	board[13][12] = 0
-	board[13][13] = 0
-
-	return board
-}
-
-func generatePowerups(level int) map[string]*Powerup {
-	powerups := make(map[string]*Powerup)
-
-	centerRow := 7
-	centerCol := 7
-
-	shieldID := newUUID()
-	powerups[shieldID] = &Powerup{
-		ID:       shieldID,
-		Type:     POWERUP_SHIELD,
-		Level:    1,
-		Position: Position{Row: centerRow, Col: centerCol},
-	}
-
-	var validPositions []Position
-	for i := 1; i < 14; i++ {
-		for j := 1; j < 14; j++ {
-			if i%2 == 0 && j%2 == 0 {
-				continue
-			}
-			if i == centerRow && j == centerCol {
-				continue
-			}
-			if ((i == centerRow-3 || i == centerRow+3) && (j >= centerCol-3 && j <= centerCol+3)) ||
-				((j == centerCol-3 || j == centerCol+3) && (i >= centerRow-3 && i <= centerRow+3)) {
-				validPositions = append(validPositions, Position{Row: i, Col: j})
-			}
-		}
-	}
-
-	for len(powerups) < 3 && len(validPositions) > 0 {
-		idx := rand.Intn(len(validPositions))
-		randomPos := validPositions[idx]
-		validPositions = append(validPositions[:idx], validPositions[idx+1:]...)
-		powerupID := newUUID()
-		powerups[powerupID] = &Powerup{
-			ID:       powerupID,
-			Type:     POWERUP_BOMB_RANGE,
-			Level:    level,
-			Position: randomPos,
-		}
-	}
-
-	return powerups
-}
-
 func removeAIFromLobby(lobbyID string) error {
 	tx, err := db.Begin()
 	if err != nil {
@@ -555,7 +615,9 @@ func removeAIFromLobby(lobbyID string) error {
 	return updateLobbyCountFromTracker(lobbyID)
 }
 
-func addAIToLobby(lobbyID, difficulty string) error {
+// addAIToLobby adds an AI slot, played by the built-in AI at difficulty or,
+// if localBot is set, by that local bot.
+func addAIToLobby(lobbyID, difficulty, localBot string) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
@@ -568,22 +630,23 @@ func addAIToLobby(lobbyID, difficulty string) error {
 		return fmt.Errorf("lobby not found")
 	}
 
-	var playersInLobby []Player
-	if playerTracker != nil {
-		ps := playerTracker.GetLobbyPlayers(lobbyID)
-		for _, s := range ps {
-			playersInLobby = append(playersInLobby, Player{ID: s.PlayerID, Name: s.PlayerName, IsAI: s.IsAI})
-		}
+	var aiSlots int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM players WHERE lobby_id = ? AND is_ai = true`, lobbyID).Scan(&aiSlots); err != nil {
+		return err
 	}
-	if len(playersInLobby) >= maxPlayers {
+	if sessionCount(lobbyID)+aiSlots >= maxPlayers {
 		return fmt.Errorf("lobby is full")
 	}
 
+	name := "AI Player"
+	if localBot != "" {
+		name = localBot
+	}
 	aiPlayerID := newUUID()
 	_, err = tx.Exec(`
-		INSERT INTO players (id, lobby_id, name, position_row, position_col, alive, bomb_count, max_bombs, bomb_range, is_ai, ai_difficulty, score)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, aiPlayerID, lobbyID, "AI Player", 2, 2, true, 0, 1, 1, true, difficulty, 0)
+		INSERT INTO players (id, lobby_id, name, position_row, position_col, alive, bomb_count, max_bombs, bomb_range, is_ai, ai_difficulty, score, local_bot)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, aiPlayerID, lobbyID, name, 2, 2, true, 0, 1, 1, true, difficulty, 0, localBot)
 	if err != nil {
 		return err
 	}
@@ -599,12 +662,28 @@ func addAIToLobby(lobbyID, difficulty string) error {
 	return updateLobbyCountFromTracker(lobbyID)
 }
 
+func sessionCount(lobbyID string) int {
+	if playerTracker == nil {
+		return 0
+	}
+	return len(playerTracker.GetLobbyPlayers(lobbyID))
+}
+
+// lobbyPlayerCount is how many seats in a lobby are taken: its players'
+// sessions and its AI slots.
+func lobbyPlayerCount(lobbyID string) int {
+	var aiSlots int
+	err := db.QueryRow(`SELECT COUNT(*) FROM players WHERE lobby_id = ? AND is_ai = true`, lobbyID).Scan(&aiSlots)
+	if err != nil {
+		logError("Failed to count AI slots", err, "lobbyID", lobbyID)
+	}
+	return sessionCount(lobbyID) + aiSlots
+}
+
 func updateLobbyCountFromTracker(lobbyID string) error {
 	if playerTracker == nil {
 		return nil
 	}
-	sessions := playerTracker.GetLobbyPlayers(lobbyID)
-	count := len(sessions)
-	_, err := db.Exec(`UPDATE lobbies SET player_count = ? WHERE id = ?`, count, lobbyID)
+	_, err := db.Exec(`UPDATE lobbies SET player_count = ? WHERE id = ?`, lobbyPlayerCount(lobbyID), lobbyID)
 	return err
 }
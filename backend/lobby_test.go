@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"soulbomber-backend/engine"
+)
+
+func TestHandleLobbiesRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		board    engine.BoardConfig
+		disabled []string
+	}{
+		{
+			name:     "board override keeps the preset's other fields",
+			body:     `{"name": "chaos", "preset": "chaos", "board": {"width": 17}}`,
+			status:   http.StatusOK,
+			board:    engine.BoardConfig{Width: 17, Height: 15, SoftDensity: 0.8, SpawnLayout: engine.SPAWN_CORNERS},
+			disabled: nil,
+		},
+		{
+			name:     "powerup toggles apply to the preset's list",
+			body:     `{"name": "hardcore", "preset": "hardcore", "powerups": {"shield": true, "kick": false, "speed": false, "pierce": true}}`,
+			status:   http.StatusOK,
+			board:    engine.DefaultBoardConfig(),
+			disabled: []string{engine.POWERUP_KICK, engine.POWERUP_SPEED},
+		},
+		{
+			name:     "disabling a disabled powerup",
+			body:     `{"name": "hardcore", "preset": "hardcore", "powerups": {"shield": false}}`,
+			status:   http.StatusOK,
+			board:    engine.DefaultBoardConfig(),
+			disabled: []string{engine.POWERUP_SHIELD},
+		},
+		{
+			name:   "invalid board",
+			body:   `{"name": "bad", "board": {"width": "wide"}}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown map",
+			body:   `{"name": "mapped", "mapId": "no-such-map"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid map ID",
+			body:   `{"name": "mapped", "mapId": "../maps"}`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+			w := httptest.NewRecorder()
+			handleLobbies(w, httptest.NewRequest("POST", "/api/lobbies", strings.NewReader(tt.body)))
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var lobby Lobby
+			if err := json.Unmarshal(w.Body.Bytes(), &lobby); err != nil {
+				t.Fatal(err)
+			}
+			if lobby.Rules.Board != tt.board {
+				t.Errorf("board %+v, want %+v", lobby.Rules.Board, tt.board)
+			}
+			if !reflect.DeepEqual(lobby.Rules.DisabledPowerups, tt.disabled) {
+				t.Errorf("disabled powerups %v, want %v", lobby.Rules.DisabledPowerups, tt.disabled)
+			}
+		})
+	}
+}
+
+func TestInvalidStoredRulesRejectLobby(t *testing.T) {
+	testDB(t)
+	hub = NewHub()
+	lobby, err := createLobby("broken", false, nil, engine.DefaultGameRules(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE lobbies SET rules = ? WHERE id = ?`, `{"tickRate": 1000}`, lobby.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, ok := getLobbyWithPlayers(lobby.ID); ok {
+		t.Error("lobby with invalid rules was returned")
+	}
+	if lobbies := getLobbies(); len(lobbies) != 0 {
+		t.Errorf("lobby with invalid rules was listed: %+v", lobbies)
+	}
+	if _, err := getLobbyRules(lobby.ID); err == nil {
+		t.Error("invalid rules were read without an error")
+	}
+}
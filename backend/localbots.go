@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+const (
+	localBotsFile = "local_bots.json"
+	// localBotPrefix marks the bot IDs of local bots, so their results sit
+	// next to WebSocket bots' without clashing with the UUIDs those get.
+	localBotPrefix = "local-"
+	// localBotStopGrace is how long a bot gets to exit after its stdin is
+	// closed before it is killed.
+	localBotStopGrace = 2 * time.Second
+	maxLocalBotLine   = 64 * 1024
+)
+
+var localBotNameRegex = regexp.MustCompile(`^[a-zA-Z0-9\-_]{1,32}$`)
+
+// LocalBot is a bot executable the server may launch for an AI slot. Only
+// bots listed in localBotsFile can be run; lobbies pick them by name.
+type LocalBot struct {
+	Name    string   `json:"name"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	Dir     string   `json:"dir,omitempty"`
+}
+
+func (b *LocalBot) ID() string {
+	return localBotPrefix + b.Name
+}
+
+var (
+	localBots   = make(map[string]*LocalBot)
+	localBotsMu sync.RWMutex
+
+	botRunners   = make(map[string][]*botRunner)
+	botRunnersMu sync.Mutex
+)
+
+// loadLocalBots reads localBotsFile and registers each bot in the bots
+// table, so its results show up alongside WebSocket bots'.
+func loadLocalBots() {
+	data, err := os.ReadFile(localBotsFile)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logError("Failed to read local bot file", err, "path", localBotsFile)
+		return
+	}
+
+	var bots []LocalBot
+	if err := json.Unmarshal(data, &bots); err != nil {
+		logError("Invalid local bot file", err, "path", localBotsFile)
+		return
+	}
+	for i := range bots {
+		bot := &bots[i]
+		if !localBotNameRegex.MatchString(bot.Name) || bot.Command == "" {
+			logError("Invalid local bot", errors.New("a local bot needs a name of up to 32 letters, digits, - or _ and a command"), "name", bot.Name)
+			continue
+		}
+		_, err := db.Exec(`
+			INSERT OR IGNORE INTO bots (id, name, token_hash, created_at)
+			VALUES (?, ?, ?, ?)
+		`, bot.ID(), bot.Name, hashBotToken(newToken()), time.Now())
+		if err != nil {
+			logError("Failed to store local bot", err, "name", bot.Name)
+			continue
+		}
+		localBotsMu.Lock()
+		localBots[bot.Name] = bot
+		localBotsMu.Unlock()
+		logInfo("Loaded local bot", "name", bot.Name, "command", bot.Command)
+	}
+}
+
+func lookupLocalBot(name string) (*LocalBot, bool) {
+	localBotsMu.RLock()
+	defer localBotsMu.RUnlock()
+	bot, ok := localBots[name]
+	return bot, ok
+}
+
+// botRunner drives one local bot process for one player. It writes an
+// observation line to the bot's stdin each tick the runner keeps up with,
+// and reads one action line back for each observation that has a deadline.
+type botRunner struct {
+	bot      *LocalBot
+	game     *engine.Game
+	playerID string
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	lines    chan []byte
+	states   chan *engine.Game
+	done     chan struct{}
+	// readDone is closed once nothing is reading the bot's stdout any more,
+	// which cmd.Wait has to wait for.
+	readDone chan struct{}
+	stopOnce sync.Once
+}
+
+// startLocalBots launches a process for every player in game that is
+// played by a local bot. A bot that can't be started just idles.
+func startLocalBots(game *engine.Game) {
+	state := game.Snapshot()
+	for _, id := range sortedKeys(state.Players) {
+		p := state.Players[id]
+		if !strings.HasPrefix(p.BotID, localBotPrefix) {
+			continue
+		}
+		bot, ok := lookupLocalBot(strings.TrimPrefix(p.BotID, localBotPrefix))
+		if !ok {
+			logError("Local bot is not configured", errors.New("unknown local bot"), "botID", p.BotID)
+			tallyBot(game.ID, p.ID, func(t *botTally) { t.Crashed = true })
+			continue
+		}
+		r, err := startBotRunner(bot, game, p.ID)
+		if err != nil {
+			logError("Failed to start local bot", err, "name", bot.Name, "gameID", game.ID)
+			tallyBot(game.ID, p.ID, func(t *botTally) { t.Crashed = true })
+			continue
+		}
+		botRunnersMu.Lock()
+		botRunners[game.ID] = append(botRunners[game.ID], r)
+		botRunnersMu.Unlock()
+	}
+}
+
+func startBotRunner(bot *LocalBot, game *engine.Game, playerID string) (*botRunner, error) {
+	cmd := exec.Command(bot.Command, bot.Args...)
+	cmd.Dir = bot.Dir
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	r := &botRunner{
+		bot:      bot,
+		game:     game,
+		playerID: playerID,
+		cmd:      cmd,
+		stdin:    stdin,
+		lines:    make(chan []byte, 16),
+		states:   make(chan *engine.Game, 1),
+		done:     make(chan struct{}),
+		readDone: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(r.readDone)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 4096), maxLocalBotLine)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case r.lines <- line:
+			case <-r.done:
+				return
+			}
+		}
+		close(r.lines)
+	}()
+	go r.run()
+
+	logInfo("Started local bot", "name", bot.Name, "gameID", game.ID, "playerID", playerID)
+	return r, nil
+}
+
+// feed hands the runner the latest state, replacing one it hasn't got to
+// yet, so a slow bot always decides on the newest tick.
+func (r *botRunner) feed(state *engine.Game) {
+	select {
+	case <-r.states:
+	default:
+	}
+	select {
+	case r.states <- state:
+	default:
+	}
+}
+
+func (r *botRunner) run() {
+	defer r.stop()
+	for {
+		var state *engine.Game
+		select {
+		case state = <-r.states:
+		case <-r.done:
+			return
+		}
+
+		player, inGame := state.Players[r.playerID]
+		decide := state.Status == "playing" && inGame && player.Alive
+		deadline := state.Rules.BotDecisionTime()
+
+		obs := newBotObservation(state)
+		obs.PlayerID = r.playerID
+		if decide {
+			obs.Deadline = deadline.Milliseconds()
+		}
+		data, err := json.Marshal(obs)
+		if err == nil {
+			_, err = r.stdin.Write(append(data, '\n'))
+		}
+		if err != nil {
+			r.crashed(err)
+			return
+		}
+		if !decide {
+			continue
+		}
+
+		if !r.await(state.Tick, deadline) {
+			return
+		}
+	}
+}
+
+// await waits for the action answering tick. It returns false once the bot
+// has exited.
+func (r *botRunner) await(tick int64, deadline time.Duration) bool {
+	timer := time.NewTimer(deadline)
+	defer timer.Stop()
+
+	for {
+		select {
+		case line, ok := <-r.lines:
+			if !ok {
+				r.crashed(errors.New("bot closed its output"))
+				return false
+			}
+			var data map[string]interface{}
+			if err := json.Unmarshal(line, &data); err != nil {
+				tallyBot(r.game.ID, r.playerID, func(t *botTally) { t.Invalid++ })
+				return true
+			}
+			if answered, _ := data["tick"].(float64); int64(answered) < tick {
+				tallyBot(r.game.ID, r.playerID, func(t *botTally) { t.Late++ })
+				continue
+			}
+			action, _ := data["type"].(string)
+			input, err := botInput(r.playerID, action, data)
+			if err != nil {
+				tallyBot(r.game.ID, r.playerID, func(t *botTally) { t.Invalid++ })
+				return true
+			}
+			if input != nil {
+				r.game.Enqueue(*input)
+			}
+			return true
+
+		case <-timer.C:
+			tallyBot(r.game.ID, r.playerID, func(t *botTally) { t.Missed++ })
+			return true
+
+		case <-r.done:
+			return false
+		}
+	}
+}
+
+func (r *botRunner) crashed(err error) {
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	logError("Local bot crashed", err, "name", r.bot.Name, "gameID", r.game.ID, "playerID", r.playerID)
+	tallyBot(r.game.ID, r.playerID, func(t *botTally) { t.Crashed = true })
+}
+
+// stop closes the bot's stdin, which is its cue to exit, and kills it if
+// it hasn't after localBotStopGrace.
+func (r *botRunner) stop() {
+	r.stopOnce.Do(func() {
+		close(r.done)
+		r.stdin.Close()
+		kill := time.AfterFunc(localBotStopGrace, func() { r.cmd.Process.Kill() })
+		go func() {
+			<-r.readDone
+			r.cmd.Wait()
+			kill.Stop()
+		}()
+	})
+}
+
+// feedLocalBots passes a game's latest state to its local bots.
+func feedLocalBots(gameID string, state *engine.Game) {
+	botRunnersMu.Lock()
+	runners := botRunners[gameID]
+	botRunnersMu.Unlock()
+	for _, r := range runners {
+		r.feed(state)
+	}
+}
+
+func stopLocalBots(gameID string) {
+	botRunnersMu.Lock()
+	runners := botRunners[gameID]
+	delete(botRunners, gameID)
+	botRunnersMu.Unlock()
+	for _, r := range runners {
+		r.stop()
+	}
+}
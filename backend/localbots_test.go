@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+func TestBotRunner(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell to run test bots with")
+	}
+	testDB(t)
+
+	tests := []struct {
+		name   string
+		script string
+		done   func(g *engine.Game, tally botTally) bool
+	}{
+		{
+			name:   "answers with a bomb",
+			script: `while read -r line; do tick=${line#*\"tick\":}; echo "{\"type\":\"placeBomb\",\"tick\":${tick%%,*}}"; done`,
+			done:   func(g *engine.Game, tally botTally) bool { return len(g.Snapshot().Bombs) == 1 },
+		},
+		{
+			name:   "garbage is invalid",
+			script: `read -r line; echo nope; cat >/dev/null`,
+			done:   func(g *engine.Game, tally botTally) bool { return tally.Invalid == 1 },
+		},
+		{
+			name:   "exiting is a crash",
+			script: `exit 0`,
+			done:   func(g *engine.Game, tally botTally) bool { return tally.Crashed },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := engine.NewGame("game-"+tt.name, "lobby", 1, engine.DefaultGameRules(), nil)
+			g.AddPlayer(engine.Player{ID: "bot", Name: "Bot"}, g.SpawnPositions()[0])
+			t.Cleanup(func() {
+				botTalliesMu.Lock()
+				delete(botTallies, g.ID)
+				botTalliesMu.Unlock()
+			})
+
+			r, err := startBotRunner(&LocalBot{Name: "test", Command: sh, Args: []string{"-c", tt.script}}, g, "bot")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				r.stop()
+				<-r.readDone
+			})
+
+			g.Step()
+			r.feed(g.Snapshot())
+			for start := time.Now(); time.Since(start) < 2*time.Second; time.Sleep(10 * time.Millisecond) {
+				g.Step()
+				var tally botTally
+				botTalliesMu.Lock()
+				if bt := botTallies[g.ID]["bot"]; bt != nil {
+					tally = *bt
+				}
+				botTalliesMu.Unlock()
+				if tt.done(g, tally) {
+					return
+				}
+			}
+			t.Error("bot runner never got there")
+		})
+	}
+}
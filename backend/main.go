@@ -3,13 +3,18 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 	_ "github.com/mattn/go-sqlite3"
+
+	"soulbomber-backend/engine"
 )
 
 var (
@@ -19,10 +24,19 @@ var (
 			return true
 		},
 		EnableCompression: true,
+		Subprotocols:      []string{binarySubprotocol},
 	}
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		if err := runSimulate(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	initLogger()
 	logInfo("Starting SoulBomber server")
 
@@ -39,6 +53,9 @@ func main() {
 	db.SetConnMaxLifetime(5 * time.Minute)
 
 	createTables()
+	loadBuiltinMaps()
+	loadAIProfiles()
+	loadLocalBots()
 
 	hub = NewHub()
 	go hub.Run()
@@ -63,7 +80,9 @@ func createTables() {
 			status TEXT DEFAULT 'waiting',
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			is_single_player BOOLEAN DEFAULT FALSE,
-			ai_players TEXT DEFAULT '[]'
+			ai_players TEXT DEFAULT '[]',
+			rules TEXT DEFAULT '{}',
+			map_id TEXT DEFAULT ''
 		)
 	`)
 	if err != nil {
@@ -84,6 +103,7 @@ func createTables() {
 			is_ai BOOLEAN DEFAULT FALSE,
 			ai_difficulty TEXT DEFAULT '',
 			score INTEGER DEFAULT 0,
+			local_bot TEXT DEFAULT '',
 			FOREIGN KEY (lobby_id) REFERENCES lobbies(id)
 		)
 	`)
@@ -100,6 +120,8 @@ func createTables() {
 			end_time DATETIME,
 			winner TEXT,
 			board TEXT DEFAULT '[]',
+			seed INTEGER DEFAULT 0,
+			match_id TEXT DEFAULT '',
 			FOREIGN KEY (lobby_id) REFERENCES lobbies(id)
 		)
 	`)
@@ -107,6 +129,91 @@ func createTables() {
 		log.Fatal(err)
 	}
 
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS matches (
+			id TEXT PRIMARY KEY,
+			lobby_id TEXT,
+			best_of INTEGER NOT NULL,
+			rounds INTEGER DEFAULT 0,
+			status TEXT DEFAULT 'playing',
+			tally TEXT DEFAULT '{}',
+			winner TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			ended_at DATETIME,
+			FOREIGN KEY (lobby_id) REFERENCES lobbies(id)
+		)
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS replays (
+			game_id TEXT PRIMARY KEY,
+			lobby_id TEXT,
+			version INTEGER NOT NULL,
+			seed INTEGER DEFAULT 0,
+			ticks INTEGER DEFAULT 0,
+			path TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (game_id) REFERENCES games(id)
+		)
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS maps (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			author TEXT DEFAULT '',
+			recommended_players INTEGER DEFAULT 0,
+			spawns INTEGER DEFAULT 0,
+			width INTEGER DEFAULT 0,
+			height INTEGER DEFAULT 0,
+			data TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS bots (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS bot_results (
+			bot_id TEXT NOT NULL,
+			game_id TEXT NOT NULL,
+			player_id TEXT NOT NULL,
+			score INTEGER DEFAULT 0,
+			won BOOLEAN DEFAULT FALSE,
+			survived BOOLEAN DEFAULT FALSE,
+			missed INTEGER DEFAULT 0,
+			late INTEGER DEFAULT 0,
+			invalid INTEGER DEFAULT 0,
+			crashed BOOLEAN DEFAULT FALSE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (bot_id, game_id, player_id),
+			FOREIGN KEY (bot_id) REFERENCES bots(id),
+			FOREIGN KEY (game_id) REFERENCES games(id)
+		)
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	_, err = db.Exec(`ALTER TABLE players ADD COLUMN score INTEGER DEFAULT 0`)
 	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
 		log.Printf("Migration warning: %v", err)
@@ -116,6 +223,36 @@ func createTables() {
 	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
 		log.Printf("Migration warning: %v", err)
 	}
+
+	_, err = db.Exec(`ALTER TABLE lobbies ADD COLUMN rules TEXT DEFAULT '{}'`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		log.Printf("Migration warning: %v", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE lobbies ADD COLUMN map_id TEXT DEFAULT ''`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		log.Printf("Migration warning: %v", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE games ADD COLUMN seed INTEGER DEFAULT 0`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		log.Printf("Migration warning: %v", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE games ADD COLUMN match_id TEXT DEFAULT ''`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		log.Printf("Migration warning: %v", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE bot_results ADD COLUMN crashed BOOLEAN DEFAULT FALSE`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		log.Printf("Migration warning: %v", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE players ADD COLUMN local_bot TEXT DEFAULT ''`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		log.Printf("Migration warning: %v", err)
+	}
 }
 
 func handleLobbies(w http.ResponseWriter, r *http.Request) {
@@ -136,9 +273,22 @@ func handleLobbies(w http.ResponseWriter, r *http.Request) {
 
 	case "POST":
 		var request struct {
-			Name           string     `json:"name"`
-			IsSinglePlayer bool       `json:"isSinglePlayer"`
-			AIPlayers      []AIPlayer `json:"aiPlayers"`
+			Name           string          `json:"name"`
+			IsSinglePlayer bool            `json:"isSinglePlayer"`
+			AIPlayers      []AIPlayer      `json:"aiPlayers"`
+			Preset         string          `json:"preset"`
+			Rules          json.RawMessage `json:"rules"`
+			Board          json.RawMessage `json:"board"`
+			MapID          string          `json:"mapId"`
+			Mode           string          `json:"mode"`
+			Lives          int             `json:"lives"`
+			Teams          *int            `json:"teams"`
+			FriendlyFire   *bool           `json:"friendlyFire"`
+			SuddenDeath    json.RawMessage `json:"suddenDeath"`
+			Powerups       map[string]bool `json:"powerups"`
+			DropChance     *float64        `json:"dropChance"`
+			DropWeights    map[string]int  `json:"dropWeights"`
+			BestOf         int             `json:"bestOf"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -155,7 +305,90 @@ func handleLobbies(w http.ResponseWriter, r *http.Request) {
 
 		request.Name = SanitizeString(request.Name)
 
-		lobby, err := createLobby(request.Name, request.IsSinglePlayer, request.AIPlayers)
+		rules, err := engine.PresetRules(request.Preset)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(request.Rules) > 0 {
+			if err := engine.ApplyRulesJSON(&rules, request.Rules); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			rules.Map = nil
+		}
+		if len(request.Board) > 0 {
+			// Only the board fields the request sets replace the preset's.
+			if err := json.Unmarshal(request.Board, &rules.Board); err != nil {
+				http.Error(w, "Invalid board", http.StatusBadRequest)
+				return
+			}
+		}
+		if request.Mode != "" {
+			rules.Mode = request.Mode
+		}
+		if request.Lives != 0 {
+			rules.Lives = request.Lives
+		}
+		if request.Teams != nil {
+			rules.Teams = *request.Teams
+		}
+		if request.FriendlyFire != nil {
+			rules.FriendlyFire = *request.FriendlyFire
+		}
+		if len(request.Powerups) > 0 {
+			rules.DisabledPowerups = togglePowerups(rules.DisabledPowerups, request.Powerups)
+		}
+		if request.DropChance != nil {
+			rules.DropChance = *request.DropChance
+		}
+		if request.DropWeights != nil {
+			rules.DropWeights = request.DropWeights
+		}
+		if request.BestOf != 0 {
+			rules.BestOf = request.BestOf
+		}
+		if len(request.SuddenDeath) > 0 {
+			if err := engine.ApplySuddenDeathJSON(&rules.SuddenDeath, request.SuddenDeath); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := rules.Validate(); err != nil {
+			logError("Invalid lobby rules", err, "name", request.Name)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if request.MapID != "" {
+			if err := ValidateMapID(request.MapID); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			m, err := getMap(request.MapID)
+			if err != nil {
+				logError("Invalid lobby map", err, "mapID", request.MapID)
+				http.Error(w, "Map not found", http.StatusBadRequest)
+				return
+			}
+			if err := m.CheckPlayers(lobbyMaxPlayers); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if len(request.AIPlayers) > lobbyMaxPlayers {
+			http.Error(w, fmt.Sprintf("a lobby can have at most %d AI players", lobbyMaxPlayers), http.StatusBadRequest)
+			return
+		}
+		for _, ai := range request.AIPlayers {
+			if err := ValidateDifficulty(ai.Difficulty); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		lobby, err := createLobby(request.Name, request.IsSinglePlayer, request.AIPlayers, rules, request.MapID)
 		if err != nil {
 			logError("Error creating lobby", err, "name", request.Name)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -300,7 +533,7 @@ func handleStartSinglePlayer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	json.NewEncoder(w).Encode(game)
+	json.NewEncoder(w).Encode(game.Snapshot())
 }
 
 func handleAddAI(w http.ResponseWriter, r *http.Request) {
@@ -327,6 +560,7 @@ func handleAddAI(w http.ResponseWriter, r *http.Request) {
 	}
 	var req struct {
 		Difficulty string `json:"difficulty"`
+		LocalBot   string `json:"localBot"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -335,17 +569,25 @@ func handleAddAI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := ValidateDifficulty(req.Difficulty); err != nil {
+	if req.LocalBot != "" {
+		if _, ok := lookupLocalBot(req.LocalBot); !ok {
+			logError("Unknown local bot", errors.New("local bot is not configured"), "localBot", req.LocalBot)
+			http.Error(w, "unknown local bot", http.StatusBadRequest)
+			return
+		}
+		req.Difficulty = ""
+	} else if err := ValidateDifficulty(req.Difficulty); err != nil {
 		logError("Invalid AI difficulty", err, "difficulty", req.Difficulty)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	err := addAIToLobby(lobbyID, req.Difficulty)
+	err := addAIToLobby(lobbyID, req.Difficulty, req.LocalBot)
 	if err != nil {
 		logError("Failed to add AI to lobby", err,
 			"lobbyID", lobbyID,
 			"difficulty", req.Difficulty,
+			"localBot", req.LocalBot,
 		)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -393,6 +635,14 @@ func handlePlayerStats(w http.ResponseWriter, r *http.Request) {
 
 	stats := playerTracker.GetPlayerStats()
 
+	spectators := hub.spectatorCounts()
+	total := 0
+	for _, count := range spectators {
+		total += count
+	}
+	stats["spectators"] = total
+	stats["spectatorLobbies"] = spectators
+
 	stats["timestamp"] = time.Now()
 	stats["uptime"] = time.Since(startTime).Seconds()
 
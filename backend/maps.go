@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+const mapDir = "maps"
+
+type MapInfo struct {
+	ID                 string    `json:"id"`
+	Name               string    `json:"name"`
+	Author             string    `json:"author"`
+	RecommendedPlayers int       `json:"recommendedPlayers"`
+	Spawns             int       `json:"spawns"`
+	Width              int       `json:"width"`
+	Height             int       `json:"height"`
+	CreatedAt          time.Time `json:"createdAt"`
+}
+
+// loadBuiltinMaps registers every map file shipped in mapDir under its file
+// name, replacing older copies so edits to the files take effect on restart.
+func loadBuiltinMaps() {
+	paths, err := filepath.Glob(filepath.Join(mapDir, "*.json"))
+	if err != nil {
+		logError("Failed to list map files", err)
+		return
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logError("Failed to read map file", err, "path", path)
+			continue
+		}
+		m, err := engine.ParseMap(data)
+		if err != nil {
+			logError("Invalid map file", err, "path", path)
+			continue
+		}
+		id := strings.TrimSuffix(filepath.Base(path), ".json")
+		if err := saveMap(id, m); err != nil {
+			logError("Failed to store map", err, "path", path)
+			continue
+		}
+		logInfo("Loaded map", "id", id, "name", m.Name)
+	}
+}
+
+func saveMap(id string, m *engine.Map) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT OR REPLACE INTO maps (id, name, author, recommended_players, spawns, width, height, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, m.Name, m.Author, m.RecommendedPlayers, len(m.SpawnPositions()), m.Width(), m.Height(), data, time.Now())
+	return err
+}
+
+func getMaps() []MapInfo {
+	rows, err := db.Query(`
+		SELECT id, name, author, recommended_players, spawns, width, height, created_at
+		FROM maps
+		ORDER BY name
+	`)
+	if err != nil {
+		logError("Error querying maps", err)
+		return []MapInfo{}
+	}
+	defer rows.Close()
+
+	maps := []MapInfo{}
+	for rows.Next() {
+		var info MapInfo
+		err := rows.Scan(
+			&info.ID,
+			&info.Name,
+			&info.Author,
+			&info.RecommendedPlayers,
+			&info.Spawns,
+			&info.Width,
+			&info.Height,
+			&info.CreatedAt,
+		)
+		if err != nil {
+			logError("Error scanning map", err)
+			continue
+		}
+		maps = append(maps, info)
+	}
+	return maps
+}
+
+func getMap(id string) (*engine.Map, error) {
+	var data string
+	err := db.QueryRow(`SELECT data FROM maps WHERE id = ?`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("map not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return engine.ParseMap([]byte(data))
+}
+
+func handleMaps(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/maps"), "/")
+
+	switch r.Method {
+	case "GET":
+		if id == "" {
+			json.NewEncoder(w).Encode(getMaps())
+			return
+		}
+		if err := ValidateMapID(id); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m, err := getMap(id)
+		if err != nil {
+			http.Error(w, "Map not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(m)
+
+	case "POST":
+		if id != "" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var m engine.Map
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&m); err != nil {
+			logError("Error decoding map", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		m.Name = SanitizeString(m.Name)
+		m.Author = SanitizeString(m.Author)
+		if err := m.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		id := newUUID()
+		if err := saveMap(id, &m); err != nil {
+			logError("Error saving map", err, "name", m.Name)
+			http.Error(w, "Failed to save map", http.StatusInternalServerError)
+			return
+		}
+		logInfo("Map uploaded", "id", id, "name", m.Name)
+		json.NewEncoder(w).Encode(map[string]string{"id": id})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
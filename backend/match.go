@@ -0,0 +1,317 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+// Match is a best-of-N series played in one lobby. Every round is an
+// ordinary game linked to the match through games.match_id; the match only
+// keeps the round-win tally, keyed by the round's winner (a player ID, or
+// "team:N" in team games).
+type Match struct {
+	ID        string         `json:"id"`
+	LobbyID   string         `json:"lobbyId"`
+	BestOf    int            `json:"bestOf"`
+	Rounds    int            `json:"rounds"`
+	Tally     map[string]int `json:"tally"`
+	Status    string         `json:"status"`
+	Winner    string         `json:"winner"`
+	Games     []string       `json:"games,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+	EndedAt   *time.Time     `json:"endedAt,omitempty"`
+
+	gameID  string
+	starter string
+	players []engine.Player
+	names   map[string]string
+}
+
+type MatchStanding struct {
+	Side string `json:"side"`
+	Name string `json:"name"`
+	Wins int    `json:"wins"`
+}
+
+var (
+	matches   = make(map[string]*Match)
+	matchesMu sync.Mutex
+)
+
+// beginRound attaches a new game to the lobby's running match, starting a
+// match first if the rules ask for more than one round. It returns the
+// match ID, or "" for a standalone game.
+func beginRound(lobbyID, gameID string, rules engine.GameRules, starter string, players []engine.Player) (string, error) {
+	matchesMu.Lock()
+	defer matchesMu.Unlock()
+
+	m := matches[lobbyID]
+	if m == nil || m.Status != "playing" {
+		if rules.BestOf <= 1 {
+			delete(matches, lobbyID)
+			return "", nil
+		}
+		m = &Match{
+			ID:        newUUID(),
+			LobbyID:   lobbyID,
+			BestOf:    rules.BestOf,
+			Tally:     make(map[string]int),
+			Status:    "playing",
+			CreatedAt: time.Now(),
+			names:     make(map[string]string),
+		}
+		_, err := db.Exec(`
+			INSERT INTO matches (id, lobby_id, best_of, rounds, status, tally, winner, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, m.ID, lobbyID, m.BestOf, 0, m.Status, "{}", "", m.CreatedAt)
+		if err != nil {
+			return "", err
+		}
+		matches[lobbyID] = m
+		logInfo("Match started", "matchID", m.ID, "lobbyID", lobbyID, "bestOf", strconv.Itoa(m.BestOf))
+	}
+
+	m.gameID = gameID
+	m.starter = starter
+	m.players = players
+	return m.ID, nil
+}
+
+// recordRound adds a finished round to the lobby's match and announces
+// either the intermission standings or the match result. Rounds nobody won
+// don't count, but a match gives up after twice its length and goes to the
+// leader, if there is one.
+func recordRound(g *engine.Game, result *engine.Game) {
+	matchesMu.Lock()
+	m := matches[g.LobbyID]
+	if m == nil || m.Status != "playing" || m.gameID != g.ID {
+		matchesMu.Unlock()
+		return
+	}
+
+	m.Rounds++
+	for _, p := range result.Players {
+		if p.Spectator {
+			continue
+		}
+		side := matchSide(g.Rules, p)
+		if _, ok := m.Tally[side]; !ok {
+			m.Tally[side] = 0
+		}
+		if side == p.ID {
+			m.names[side] = p.Name
+		} else {
+			m.names[side] = fmt.Sprintf("Team %d", p.Team)
+		}
+	}
+	if result.Winner != "" {
+		m.Tally[result.Winner]++
+	}
+
+	leader, wins, tied := m.leader()
+	if wins >= g.Rules.RoundsToWin() || m.Rounds >= 2*m.BestOf {
+		if !tied {
+			m.Winner = leader
+		}
+		m.Status = "finished"
+		now := time.Now()
+		m.EndedAt = &now
+	}
+
+	standings := m.standings()
+	payload := map[string]interface{}{
+		"match":       m.snapshot(),
+		"standings":   standings,
+		"roundWinner": result.Winner,
+	}
+	finished := m.Status == "finished"
+	if finished {
+		delete(matches, g.LobbyID)
+	}
+	matchesMu.Unlock()
+
+	if err := saveMatch(m); err != nil {
+		logError("Failed to save match", err, "matchID", m.ID)
+	}
+
+	if finished {
+		logInfo("Match finished", "matchID", m.ID, "winner", m.Winner, "rounds", strconv.Itoa(m.Rounds))
+		broadcastToLobby(g.LobbyID, "matchEnd", payload)
+		return
+	}
+	payload["nextRound"] = m.Rounds + 1
+	payload["intermission"] = engine.FinishedLinger.Milliseconds()
+	broadcastToLobby(g.LobbyID, "matchIntermission", payload)
+}
+
+// continueMatch starts the next round once a finished round has ended, if
+// the round belonged to a match that is still undecided and anyone is left
+// in the lobby to play it.
+func continueMatch(g *engine.Game) {
+	matchesMu.Lock()
+	m := matches[g.LobbyID]
+	if m == nil || m.Status != "playing" || m.gameID != g.ID {
+		matchesMu.Unlock()
+		return
+	}
+	starter, players := m.starter, m.players
+	matchesMu.Unlock()
+
+	if playerTracker != nil && len(playerTracker.GetLobbyPlayers(g.LobbyID)) == 0 {
+		abandonMatch(g.LobbyID, "lobby is empty")
+		return
+	}
+
+	game, err := startGameInternal(g.LobbyID, starter, players)
+	if err != nil {
+		logError("Failed to start next match round", err, "matchID", m.ID)
+		abandonMatch(g.LobbyID, err.Error())
+		return
+	}
+	broadcastToLobby(g.LobbyID, "gameState", game.Snapshot())
+}
+
+func abandonMatch(lobbyID, reason string) {
+	matchesMu.Lock()
+	m := matches[lobbyID]
+	if m == nil {
+		matchesMu.Unlock()
+		return
+	}
+	delete(matches, lobbyID)
+	m.Status = "abandoned"
+	now := time.Now()
+	m.EndedAt = &now
+	matchesMu.Unlock()
+
+	logInfo("Match abandoned", "matchID", m.ID, "reason", reason)
+	if err := saveMatch(m); err != nil {
+		logError("Failed to save match", err, "matchID", m.ID)
+	}
+}
+
+func matchSide(rules engine.GameRules, p *engine.Player) string {
+	if rules.TeamMode() && p.Team > 0 {
+		return engine.TeamWinner(p.Team)
+	}
+	return p.ID
+}
+
+// leader reports the side with the most round wins and whether another
+// side has as many.
+func (m *Match) leader() (string, int, bool) {
+	leader, wins, tied := "", 0, false
+	for _, side := range sortedKeys(m.Tally) {
+		switch {
+		case m.Tally[side] > wins:
+			leader, wins, tied = side, m.Tally[side], false
+		case m.Tally[side] == wins:
+			tied = true
+		}
+	}
+	return leader, wins, tied
+}
+
+// standings lists every side that has played in the match, most wins first.
+func (m *Match) standings() []MatchStanding {
+	standings := make([]MatchStanding, 0, len(m.Tally))
+	for _, side := range sortedKeys(m.Tally) {
+		standings = append(standings, MatchStanding{Side: side, Name: m.names[side], Wins: m.Tally[side]})
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		return standings[i].Wins > standings[j].Wins
+	})
+	return standings
+}
+
+func (m *Match) snapshot() Match {
+	snapshot := *m
+	snapshot.Tally = make(map[string]int, len(m.Tally))
+	for side, wins := range m.Tally {
+		snapshot.Tally[side] = wins
+	}
+	return snapshot
+}
+
+func saveMatch(m *Match) error {
+	matchesMu.Lock()
+	tally, err := json.Marshal(m.Tally)
+	rounds, status, winner, endedAt := m.Rounds, m.Status, m.Winner, m.EndedAt
+	matchesMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		UPDATE matches SET rounds = ?, status = ?, tally = ?, winner = ?, ended_at = ?
+		WHERE id = ?
+	`, rounds, status, string(tally), winner, endedAt, m.ID)
+	return err
+}
+
+func getMatch(id string) (*Match, error) {
+	var m Match
+	var tally string
+	var endedAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT id, lobby_id, best_of, rounds, status, tally, winner, created_at, ended_at
+		FROM matches
+		WHERE id = ?
+	`, id).Scan(&m.ID, &m.LobbyID, &m.BestOf, &m.Rounds, &m.Status, &tally, &m.Winner, &m.CreatedAt, &endedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("match not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(tally), &m.Tally); err != nil {
+		return nil, err
+	}
+	if endedAt.Valid {
+		m.EndedAt = &endedAt.Time
+	}
+
+	rows, err := db.Query(`SELECT id FROM games WHERE match_id = ? ORDER BY start_time`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var gameID string
+		if err := rows.Scan(&gameID); err != nil {
+			return nil, err
+		}
+		m.Games = append(m.Games, gameID)
+	}
+	return &m, rows.Err()
+}
+
+func handleMatch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matchID := r.URL.Path[len("/api/matches/"):]
+	if err := ValidateUUID(matchID); err != nil {
+		http.Error(w, "Invalid match ID", http.StatusBadRequest)
+		return
+	}
+
+	m, err := getMatch(matchID)
+	if err != nil {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(m)
+}
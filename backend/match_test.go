@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"testing"
+
+	"soulbomber-backend/engine"
+)
+
+// testDB points db at a fresh in-memory database for the length of a test,
+// and sends the file log nowhere.
+func testDB(t *testing.T) {
+	t.Helper()
+	logger = log.New(io.Discard, "", 0)
+	var err error
+	db, err = sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is its own database.
+	db.SetMaxOpenConns(1)
+	createTables()
+	t.Cleanup(func() { db.Close() })
+}
+
+// nextMessageType reads the type of the next message sent to conn.
+func nextMessageType(t *testing.T, conn *Connection) string {
+	t.Helper()
+	select {
+	case data := <-conn.Send:
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg.Type
+	default:
+		return "nothing"
+	}
+}
+
+func TestRecordRound(t *testing.T) {
+	tests := []struct {
+		name       string
+		teams      int
+		winners    []string // round winners in order, "" for a round nobody won
+		wantRounds int
+		wantWinner string
+	}{
+		{name: "majority ends the match early", winners: []string{"a", "a"}, wantRounds: 2, wantWinner: "a"},
+		{name: "split goes the distance", winners: []string{"a", "b", "b"}, wantRounds: 3, wantWinner: "b"},
+		{name: "draws don't count", winners: []string{"a", "", "b", "", "a"}, wantRounds: 5, wantWinner: "a"},
+		{name: "leader takes it after twice the length", winners: []string{"", "b", "", "", "", ""}, wantRounds: 6, wantWinner: "b"},
+		{name: "tie after twice the length has no winner", winners: []string{"a", "b", "", "", "", ""}, wantRounds: 6},
+		{
+			name:       "teams",
+			teams:      2,
+			winners:    []string{engine.TeamWinner(2), engine.TeamWinner(1), engine.TeamWinner(2)},
+			wantRounds: 3,
+			wantWinner: engine.TeamWinner(2),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+			conn := testLobbyConn(t, "lobby")
+			t.Cleanup(func() { delete(matches, "lobby") })
+
+			rules := engine.DefaultGameRules()
+			rules.BestOf = 3
+			rules.Teams = tt.teams
+			players := []engine.Player{{ID: "a", Name: "Al", Team: 1}, {ID: "b", Name: "Bea", Team: 2}}
+
+			var matchID string
+			for i, winner := range tt.winners {
+				gameID := fmt.Sprintf("game-%d", i)
+				id, err := beginRound("lobby", gameID, rules, "a", players)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if matchID == "" {
+					matchID = id
+				} else if id != matchID {
+					t.Fatalf("round %d started match %s, want %s", i+1, id, matchID)
+				}
+
+				g := engine.NewGame(gameID, "lobby", 1, rules, nil)
+				spawns := g.SpawnPositions()
+				for j, p := range players {
+					g.AddPlayer(p, spawns[j])
+				}
+				result := g.Snapshot()
+				result.Winner = winner
+				recordRound(g, result)
+
+				want := "matchIntermission"
+				if i == len(tt.winners)-1 {
+					want = "matchEnd"
+				}
+				if got := nextMessageType(t, conn); got != want {
+					t.Fatalf("round %d announced %s, want %s", i+1, got, want)
+				}
+			}
+
+			if _, ok := matches["lobby"]; ok {
+				t.Error("finished match is still running")
+			}
+			m, err := getMatch(matchID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Status != "finished" || m.Rounds != tt.wantRounds || m.Winner != tt.wantWinner {
+				t.Errorf("match %s after %d rounds won by %q, want finished after %d won by %q",
+					m.Status, m.Rounds, m.Winner, tt.wantRounds, tt.wantWinner)
+			}
+		})
+	}
+}
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
 	"time"
 )
 
+// adminTokenEnv names the environment variable holding the token that
+// privileged requests must carry. Those requests are refused while it is
+// unset.
+const adminTokenEnv = "SOULBOMBER_ADMIN_TOKEN"
+
 type RateLimiter struct {
 	requests map[string][]time.Time
 	mu sync.RWMutex
@@ -130,3 +138,20 @@ func RecoveryMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r)
 	}
 }
+
+// requireAdmin reports whether r carries the admin token as a bearer
+// token, answering the request itself if it doesn't.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := os.Getenv(adminTokenEnv)
+	if token == "" {
+		http.Error(w, "Admin access is not configured", http.StatusForbidden)
+		return false
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		logInfo("Rejected admin request", "path", r.URL.Path, "ip", getClientIP(r))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	logger = log.New(io.Discard, "", 0)
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{name: "not configured", header: "Bearer secret", want: http.StatusForbidden},
+		{name: "missing", token: "secret", want: http.StatusUnauthorized},
+		{name: "wrong", token: "secret", header: "Bearer guess", want: http.StatusUnauthorized},
+		{name: "not bearer", token: "secret", header: "secret", want: http.StatusUnauthorized},
+		{name: "matches", token: "secret", header: "Bearer secret", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(adminTokenEnv, tt.token)
+			r := httptest.NewRequest(http.MethodPost, "/api/bots", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			if ok := requireAdmin(w, r); ok != (tt.want == http.StatusOK) {
+				t.Fatalf("requireAdmin returned %v", ok)
+			}
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
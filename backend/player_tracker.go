@@ -12,10 +12,12 @@ type PlayerSession struct {
 	LobbyID      string          `json:"lobbyId"`
 	PlayerName   string          `json:"playerName"`
 	IsAI         bool            `json:"isAI"`
+	BotID        string          `json:"botId,omitempty"`
 	ConnectedAt  time.Time       `json:"connectedAt"`
 	LastSeen     time.Time       `json:"lastSeen"`
 	Heartbeat    time.Time       `json:"heartbeat"`
 	Status       string          `json:"status"`
+	Team         int             `json:"team"`
 	WebSocketIDs map[string]bool `json:"websocketIds"`
 }
 
@@ -142,6 +144,32 @@ func (pt *PlayerTracker) UpdatePlayerName(playerID, playerName string) {
 	}
 }
 
+func (pt *PlayerTracker) SetPlayerTeam(playerID string, team int) {
+	pt.sessionsMu.Lock()
+	defer pt.sessionsMu.Unlock()
+
+	if session, exists := pt.sessions[playerID]; exists {
+		session.Team = team
+		session.LastSeen = time.Now()
+
+		logInfo("Player team updated",
+			"playerID", playerID,
+			"team", fmt.Sprintf("%d", team),
+			"lobbyID", session.LobbyID,
+		)
+	}
+}
+
+// SetPlayerBot marks a session as played by the external bot botID.
+func (pt *PlayerTracker) SetPlayerBot(playerID, botID string) {
+	pt.sessionsMu.Lock()
+	defer pt.sessionsMu.Unlock()
+
+	if session, exists := pt.sessions[playerID]; exists {
+		session.BotID = botID
+	}
+}
+
 func (pt *PlayerTracker) UnregisterPlayer(playerID, websocketID string) {
 	pt.sessionsMu.Lock()
 	session, exists := pt.sessions[playerID]
@@ -173,6 +201,26 @@ func (pt *PlayerTracker) UnregisterPlayer(playerID, websocketID string) {
 	pt.sessionsMu.Unlock()
 }
 
+// DetachConnection drops one of a player's connections. Unlike
+// UnregisterPlayer it keeps the session when that was the last connection,
+// marking it disconnected instead. It returns how many connections the
+// player still has.
+func (pt *PlayerTracker) DetachConnection(playerID, websocketID string) int {
+	pt.sessionsMu.Lock()
+	defer pt.sessionsMu.Unlock()
+
+	session, exists := pt.sessions[playerID]
+	if !exists {
+		return 0
+	}
+	delete(session.WebSocketIDs, websocketID)
+	if len(session.WebSocketIDs) == 0 {
+		session.Status = "disconnected"
+		session.LastSeen = time.Now()
+	}
+	return len(session.WebSocketIDs)
+}
+
 func (pt *PlayerTracker) GetPlayerSession(playerID string) *PlayerSession {
 	pt.sessionsMu.RLock()
 	defer pt.sessionsMu.RUnlock()
@@ -218,6 +266,7 @@ func (pt *PlayerTracker) GetPlayerStats() map[string]interface{} {
 		"idlePlayers":         0,
 		"disconnectedPlayers": 0,
 		"aiPlayers":           0,
+		"botPlayers":          0,
 		"humanPlayers":        0,
 		"lobbies":             make(map[string]int),
 	}
@@ -234,6 +283,8 @@ func (pt *PlayerTracker) GetPlayerStats() map[string]interface{} {
 
 		if session.IsAI {
 			stats["aiPlayers"] = stats["aiPlayers"].(int) + 1
+		} else if session.BotID != "" {
+			stats["botPlayers"] = stats["botPlayers"].(int) + 1
 		} else {
 			stats["humanPlayers"] = stats["humanPlayers"].(int) + 1
 		}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"soulbomber-backend/engine"
+)
+
+type PowerupInfo struct {
+	Name      string   `json:"name"`
+	Levels    int      `json:"levels"`
+	Sprites   []string `json:"sprites"`
+	Weight    int      `json:"weight"`
+	MaxStacks int      `json:"maxStacks"`
+	Combines  bool     `json:"combines"`
+}
+
+func getPowerupInfo() []PowerupInfo {
+	var infos []PowerupInfo
+	for _, t := range engine.PowerupTypes() {
+		info := PowerupInfo{
+			Name:      t.Name,
+			Levels:    t.Levels,
+			Weight:    t.Weight,
+			MaxStacks: t.MaxStacks,
+			Combines:  t.Combines,
+		}
+		for level := 1; level <= t.Levels; level++ {
+			info.Sprites = append(info.Sprites, t.Sprite(level))
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// togglePowerups applies a lobby's powerup toggles to the preset's disabled
+// list: true enables a type, false disables it. The result is sorted and
+// has no duplicates, so identical requests store identical rules.
+func togglePowerups(disabled []string, toggles map[string]bool) []string {
+	off := make(map[string]bool, len(disabled)+len(toggles))
+	for _, name := range disabled {
+		off[name] = true
+	}
+	for name, on := range toggles {
+		off[name] = !on
+	}
+
+	var names []string
+	for _, name := range sortedKeys(off) {
+		if off[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func handlePowerups(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	json.NewEncoder(w).Encode(getPowerupInfo())
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+// seat is a player's place in a lobby. While they are disconnected from a
+// running game the seat is held for the lobby's grace period, and a client
+// presenting the seat's token gets the same character back.
+type seat struct {
+	Token    string
+	PlayerID string
+	LobbyID  string
+	Name     string
+	held     bool
+	gen      int
+}
+
+var (
+	seats   = make(map[string]*seat)
+	seatsMu sync.Mutex
+)
+
+// issueReconnectToken gives a player who just joined a lobby a fresh seat,
+// replacing any token they held before, and sends them the token.
+func (c *Connection) issueReconnectToken(lobbyID, playerID, playerName string) {
+	revokeSeats(playerID)
+	rules, err := getLobbyRules(lobbyID)
+	if err != nil {
+		logError("Failed to issue reconnect token", err, "lobbyID", lobbyID, "playerID", playerID)
+		return
+	}
+
+	s := &seat{
+		Token:    newToken(),
+		PlayerID: playerID,
+		LobbyID:  lobbyID,
+		Name:     playerName,
+	}
+	seatsMu.Lock()
+	seats[s.Token] = s
+	seatsMu.Unlock()
+
+	c.sendMessage("reconnectToken", map[string]interface{}{
+		"token":       s.Token,
+		"gracePeriod": rules.ReconnectGrace.Milliseconds(),
+	})
+}
+
+func revokeSeats(playerID string) {
+	seatsMu.Lock()
+	defer seatsMu.Unlock()
+	for token, s := range seats {
+		if s.PlayerID == playerID {
+			delete(seats, token)
+		}
+	}
+}
+
+func seatFor(playerID, lobbyID string) *seat {
+	for _, s := range seats {
+		if s.PlayerID == playerID && s.LobbyID == lobbyID {
+			return s
+		}
+	}
+	return nil
+}
+
+// holdSeat is called when c has closed. If c was the player's last
+// connection to a lobby with a game they are in, their session and
+// character are kept for the grace period, played by the AI meanwhile if
+// the lobby allows it, and it returns true. Otherwise the caller should let
+// the player go as before.
+func holdSeat(c *Connection) bool {
+	if c.LobbyID == "" {
+		return false
+	}
+	game := getGameByLobbyID(c.LobbyID)
+	if game == nil || !game.HasPlayer(c.PlayerID) || game.Rules.ReconnectGrace <= 0 {
+		return false
+	}
+
+	seatsMu.Lock()
+	s := seatFor(c.PlayerID, c.LobbyID)
+	seatsMu.Unlock()
+	if s == nil {
+		return false
+	}
+
+	if playerTracker.DetachConnection(c.PlayerID, c.ID) > 0 {
+		return true
+	}
+
+	grace := game.Rules.ReconnectGrace
+	seatsMu.Lock()
+	s.held = true
+	s.gen++
+	gen := s.gen
+	seatsMu.Unlock()
+	time.AfterFunc(grace, func() {
+		expireSeat(s, gen)
+	})
+
+	logInfo("Holding seat for disconnected player", "playerID", c.PlayerID, "lobbyID", c.LobbyID, "grace", grace.String())
+	broadcastToLobby(c.LobbyID, "playerDisconnected", map[string]interface{}{
+		"playerId":    c.PlayerID,
+		"gracePeriod": grace.Milliseconds(),
+	})
+	if game.Rules.AITakeover {
+		game.Enqueue(engine.Input{Type: engine.INPUT_AI_CONTROL, PlayerID: c.PlayerID, Difficulty: game.Rules.TakeoverDifficulty})
+	}
+	return true
+}
+
+// expireSeat gives up on a player who didn't come back in time: their
+// character leaves the game or, if the lobby asks for it, stays with the
+// AI for good, and the session is dropped.
+func expireSeat(s *seat, gen int) {
+	seatsMu.Lock()
+	if seats[s.Token] != s || !s.held || s.gen != gen {
+		seatsMu.Unlock()
+		return
+	}
+	delete(seats, s.Token)
+	seatsMu.Unlock()
+
+	replaced := false
+	if game := getGameByLobbyID(s.LobbyID); game != nil && game.HasPlayer(s.PlayerID) {
+		if game.Rules.ReplaceWithAI {
+			if !game.Rules.AITakeover {
+				game.Enqueue(engine.Input{Type: engine.INPUT_AI_CONTROL, PlayerID: s.PlayerID, Difficulty: game.Rules.TakeoverDifficulty})
+			}
+			replaced = true
+		} else {
+			game.Enqueue(engine.Input{Type: engine.INPUT_LEAVE, PlayerID: s.PlayerID})
+		}
+	}
+
+	playerTracker.UnregisterPlayer(s.PlayerID, "")
+	leaveLobby(s.LobbyID, s.PlayerID)
+
+	logInfo("Seat expired", "playerID", s.PlayerID, "lobbyID", s.LobbyID)
+	broadcastToLobby(s.LobbyID, "playerTimedOut", map[string]interface{}{
+		"playerId":     s.PlayerID,
+		"replacedByAI": replaced,
+	})
+	broadcastLobbyUpdate(s.LobbyID)
+}
+
+// handleReconnect attaches c to the seat named by the token and sends it
+// the full game state.
+func (c *Connection) handleReconnect(payload interface{}) error {
+	data, ok := payload.(map[string]interface{})
+	if !ok {
+		return c.sendError("Invalid payload format")
+	}
+
+	token, ok := data["token"].(string)
+	if !ok || token == "" {
+		return c.sendError("Missing token")
+	}
+
+	seatsMu.Lock()
+	s := seats[token]
+	if s != nil {
+		s.held = false
+	}
+	seatsMu.Unlock()
+	if s == nil {
+		return c.sendError("Reconnect token is invalid or has expired")
+	}
+
+	c.PlayerID = s.PlayerID
+	playerTracker.RegisterPlayer(s.PlayerID, s.LobbyID, s.Name, c.ID, false)
+	playerTracker.UpdatePlayerStatus(s.PlayerID, "active")
+	assignTeam(s.LobbyID, s.PlayerID)
+
+	c.readDeltaOption(data)
+	c.mu.Lock()
+	c.lastStateTick = -1
+	c.mu.Unlock()
+
+	oldLobby := c.LobbyID
+	c.LobbyID = s.LobbyID
+	hub.setConnectionLobby(c, oldLobby)
+
+	logInfo("Player reconnected to seat", "playerID", s.PlayerID, "lobbyID", s.LobbyID)
+	c.sendMessage("reconnected", map[string]interface{}{
+		"playerId": s.PlayerID,
+		"lobbyId":  s.LobbyID,
+	})
+	if game := getGameByLobbyID(s.LobbyID); game != nil && game.HasPlayer(s.PlayerID) {
+		if game.Rules.AITakeover {
+			game.Enqueue(engine.Input{Type: engine.INPUT_HUMAN_CONTROL, PlayerID: s.PlayerID})
+		}
+		c.sendMessage("gameState", game.Snapshot())
+	}
+
+	broadcastToLobby(s.LobbyID, "playerReconnected", map[string]interface{}{
+		"playerId": s.PlayerID,
+	})
+	broadcastLobbyUpdate(s.LobbyID)
+	return nil
+}
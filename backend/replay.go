@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+const replayDir = "replays"
+
+var replayMessages = map[string]bool{
+	"ping": true,
+}
+
+func saveReplay(g *engine.Game) error {
+	if err := os.MkdirAll(replayDir, 0755); err != nil {
+		return err
+	}
+
+	replay := g.Replay()
+	path := filepath.Join(replayDir, replay.GameID+".sbr")
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := engine.WriteReplay(f, replay); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT OR REPLACE INTO replays (game_id, lobby_id, version, seed, ticks, path, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, replay.GameID, replay.LobbyID, replay.Version, replay.Seed, replay.Ticks, path, time.Now())
+	return err
+}
+
+func getReplayPath(gameID string) (string, error) {
+	var path string
+	err := db.QueryRow(`SELECT path FROM replays WHERE game_id = ?`, gameID).Scan(&path)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("replay not found")
+	}
+	return path, err
+}
+
+func loadReplay(gameID string) (*engine.Replay, error) {
+	path, err := getReplayPath(gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return engine.ReadReplay(f)
+}
+
+func handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	gameID := r.URL.Path[len("/api/replays/"):]
+	if err := ValidateUUID(gameID); err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	path, err := getReplayPath(gameID)
+	if err != nil {
+		logError("Replay lookup failed", err, "gameID", gameID)
+		http.Error(w, "Replay not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", gameID+".sbr"))
+	http.ServeFile(w, r, path)
+}
+
+// replayHost sends a reconstructed game to a single spectator connection
+// instead of the lobby.
+type replayHost struct {
+	conn *Connection
+}
+
+func (h replayHost) Broadcast(g *engine.Game, msgType string, payload interface{}) {
+	h.conn.Hub.sendToConnection(h.conn, msgType, payload)
+}
+
+func (replayHost) SendToPlayer(*engine.Game, string, string, interface{}) {}
+func (replayHost) GameFinished(*engine.Game, *engine.Game)                {}
+func (replayHost) GameEnded(*engine.Game)                                 {}
+
+func streamReplay(c *Connection, replay *engine.Replay, speed float64) {
+	g := engine.NewReplayGame(replay, replayHost{conn: c})
+
+	c.Hub.sendToConnection(c, "replayStart", map[string]interface{}{
+		"gameId": replay.GameID,
+		"seed":   replay.Seed,
+		"ticks":  replay.Ticks,
+		"speed":  speed,
+	})
+	c.Hub.sendToConnection(c, "gameState", g.Snapshot())
+
+	interval := time.Duration(float64(replay.Rules.TickInterval()) / speed)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for tick := int64(0); tick < replay.Ticks; tick++ {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			g.Step()
+		}
+	}
+
+	c.Hub.sendToConnection(c, "replayEnd", map[string]string{"gameId": replay.GameID})
+}
+
+func handleReplayWebSocket(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	gameID := query.Get("gameId")
+	if err := ValidateUUID(gameID); err != nil {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	speed, err := ParseReplaySpeed(query.Get("speed"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	replay, err := loadReplay(gameID)
+	if err != nil {
+		logError("Failed to load replay", err, "gameID", gameID)
+		http.Error(w, "Replay not found", http.StatusNotFound)
+		return
+	}
+
+	connection := upgradeConnection(w, r)
+	if connection == nil {
+		return
+	}
+
+	logInfo("Streaming replay", "gameID", gameID, "speed", fmt.Sprintf("%.1f", speed))
+	go streamReplay(connection, replay, speed)
+}
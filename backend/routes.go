@@ -14,6 +14,14 @@ func setupRoutes() {
 	http.HandleFunc("/health", handleHealthCheckRoute)
 	http.HandleFunc("/metrics", handleMetricsRoute)
 	http.HandleFunc("/api/players/stats", handlePlayerStatsRoute)
+	http.HandleFunc("/api/replays/", handleReplayRoute)
+	http.HandleFunc("/api/maps", handleMapsRoute)
+	http.HandleFunc("/api/maps/", handleMapsRoute)
+	http.HandleFunc("/api/powerups", handlePowerupsRoute)
+	http.HandleFunc("/api/ai-profiles", handleAIProfilesRoute)
+	http.HandleFunc("/api/matches/", handleMatchRoute)
+	http.HandleFunc("/api/bots", handleBotsRoute)
+	http.HandleFunc("/api/bots/", handleBotsRoute)
 
 	http.HandleFunc("/css/", handleStaticFiles(http.StripPrefix("/css/", http.FileServer(http.Dir("../frontend/css")))))
 	http.HandleFunc("/js/", handleStaticFiles(http.StripPrefix("/js/", http.FileServer(http.Dir("../frontend/js")))))
@@ -130,6 +138,66 @@ func handlePlayerStatsRoute(w http.ResponseWriter, r *http.Request) {
 	)(w, r)
 }
 
+func handleReplayRoute(w http.ResponseWriter, r *http.Request) {
+	RecoveryMiddleware(
+		LoggingMiddleware(
+			RateLimitMiddleware(30, time.Minute)(
+				CORSMiddleware(handleReplay),
+			),
+		),
+	)(w, r)
+}
+
+func handleMapsRoute(w http.ResponseWriter, r *http.Request) {
+	RecoveryMiddleware(
+		LoggingMiddleware(
+			RateLimitMiddleware(30, time.Minute)(
+				CORSMiddleware(handleMaps),
+			),
+		),
+	)(w, r)
+}
+
+func handlePowerupsRoute(w http.ResponseWriter, r *http.Request) {
+	RecoveryMiddleware(
+		LoggingMiddleware(
+			RateLimitMiddleware(30, time.Minute)(
+				CORSMiddleware(handlePowerups),
+			),
+		),
+	)(w, r)
+}
+
+func handleAIProfilesRoute(w http.ResponseWriter, r *http.Request) {
+	RecoveryMiddleware(
+		LoggingMiddleware(
+			RateLimitMiddleware(30, time.Minute)(
+				CORSMiddleware(handleAIProfiles),
+			),
+		),
+	)(w, r)
+}
+
+func handleBotsRoute(w http.ResponseWriter, r *http.Request) {
+	RecoveryMiddleware(
+		LoggingMiddleware(
+			RateLimitMiddleware(30, time.Minute)(
+				CORSMiddleware(handleBots),
+			),
+		),
+	)(w, r)
+}
+
+func handleMatchRoute(w http.ResponseWriter, r *http.Request) {
+	RecoveryMiddleware(
+		LoggingMiddleware(
+			RateLimitMiddleware(30, time.Minute)(
+				CORSMiddleware(handleMatch),
+			),
+		),
+	)(w, r)
+}
+
 func handleStaticFiles(fs http.Handler) http.HandlerFunc {
 	return RecoveryMiddleware(
 		LoggingMiddleware(fs.ServeHTTP),
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+// simLengthBucket is the width of the game-length histogram's bars.
+const simLengthBucket = 15 * time.Second
+
+// pickupBuckets group players by how many powerups they picked up in a
+// game, to show how much pickups are worth.
+var pickupBuckets = []struct {
+	Label string
+	Max   int
+}{
+	{"0", 0},
+	{"1-2", 2},
+	{"3-5", 5},
+	{"6+", -1},
+}
+
+type SimConfig struct {
+	Preset    string   `json:"preset"`
+	Width     int      `json:"width"`
+	Height    int      `json:"height"`
+	AIs       []string `json:"ais"`
+	FirstSeed int64    `json:"firstSeed"`
+	LastSeed  int64    `json:"lastSeed"`
+}
+
+type SimDifficultyStats struct {
+	Difficulty   string  `json:"difficulty"`
+	Players      int     `json:"players"`
+	Wins         int     `json:"wins"`
+	WinRate      float64 `json:"winRate"`
+	AvgScore     float64 `json:"avgScore"`
+	AvgTiles     float64 `json:"avgTilesDestroyed"`
+	AvgKills     float64 `json:"avgKills"`
+	AvgDeaths    float64 `json:"avgDeaths"`
+	AvgPickups   float64 `json:"avgPickups"`
+	totalScore   int
+	totalTiles   int
+	totalKills   int
+	totalDeaths  int
+	totalPickups int
+}
+
+type SimPickupStats struct {
+	Pickups  string  `json:"pickups"`
+	Players  int     `json:"players"`
+	WinRate  float64 `json:"winRate"`
+	AvgScore float64 `json:"avgScore"`
+	wins     int
+	score    int
+}
+
+type SimLengthBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Games int     `json:"games"`
+}
+
+type SimReport struct {
+	Config       SimConfig             `json:"config"`
+	Games        int                   `json:"games"`
+	Draws        int                   `json:"draws"`
+	Elapsed      float64               `json:"elapsedSeconds"`
+	Difficulties []*SimDifficultyStats `json:"difficulties"`
+	Pickups      []*SimPickupStats     `json:"pickupImpact"`
+	MinLength    float64               `json:"minLengthSeconds"`
+	AvgLength    float64               `json:"avgLengthSeconds"`
+	MedianLength float64               `json:"medianLengthSeconds"`
+	P90Length    float64               `json:"p90LengthSeconds"`
+	MaxLength    float64               `json:"maxLengthSeconds"`
+	Lengths      []*SimLengthBucket    `json:"lengthDistribution"`
+}
+
+// simHost keeps the final state of the one round it hosts.
+type simHost struct {
+	result *engine.Game
+}
+
+func (h *simHost) Broadcast(*engine.Game, string, interface{})            {}
+func (h *simHost) SendToPlayer(*engine.Game, string, string, interface{}) {}
+func (h *simHost) GameEnded(*engine.Game)                                 {}
+
+func (h *simHost) GameFinished(g *engine.Game, result *engine.Game) {
+	h.result = result
+}
+
+// simResult is one simulated round: the final state, every player's stats
+// and which difficulty played each player.
+type simResult struct {
+	state        *engine.Game
+	stats        map[string]engine.PlayerStats
+	difficulties map[string]string
+}
+
+// runSimulate is the simulate subcommand. It plays AI-only rounds for every
+// seed in a range, spread over all CPUs, and prints aggregate stats.
+func runSimulate(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	preset := fs.String("preset", engine.PRESET_CLASSIC, "rules preset")
+	width := fs.Int("width", 0, "board width (default: the preset's)")
+	height := fs.Int("height", 0, "board height (default: the preset's)")
+	ais := fs.String("ai", "easy,medium,hard,chosen_one", "comma-separated AI difficulty of each player")
+	seeds := fs.String("seeds", "1-1000", "seed range, FIRST-LAST")
+	workers := fs.Int("workers", runtime.NumCPU(), "rounds to play at once")
+	profiles := fs.String("profiles", aiProfilesFile, "AI profile file to apply, if it exists")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := loadSimProfiles(*profiles); err != nil {
+		return err
+	}
+
+	cfg := SimConfig{Preset: *preset, Width: *width, Height: *height}
+	for _, name := range strings.Split(*ais, ",") {
+		name = strings.TrimSpace(name)
+		if err := ValidateDifficulty(name); err != nil {
+			return err
+		}
+		cfg.AIs = append(cfg.AIs, name)
+	}
+	first, last, err := parseSeedRange(*seeds)
+	if err != nil {
+		return err
+	}
+	cfg.FirstSeed, cfg.LastSeed = first, last
+	if *workers < 1 {
+		return errors.New("workers must be at least 1")
+	}
+
+	rules, err := simRules(cfg)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	results := simulateRounds(cfg, rules, *workers)
+	report := buildSimReport(cfg, results)
+	report.Elapsed = time.Since(started).Seconds()
+
+	if *asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	printSimReport(out, report)
+	return nil
+}
+
+func loadSimProfiles(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	profiles, err := engine.ParseAIProfiles(data)
+	if err != nil {
+		return err
+	}
+	for _, p := range profiles {
+		if err := engine.SetAIProfile(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseSeedRange(s string) (int64, int64, error) {
+	from, to, found := strings.Cut(s, "-")
+	first, err := strconv.ParseInt(from, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid seed range: %s", s)
+	}
+	last := first
+	if found {
+		last, err = strconv.ParseInt(to, 10, 64)
+		if err != nil || last < first {
+			return 0, 0, fmt.Errorf("invalid seed range: %s", s)
+		}
+	}
+	return first, last, nil
+}
+
+func simRules(cfg SimConfig) (engine.GameRules, error) {
+	rules, err := engine.PresetRules(cfg.Preset)
+	if err != nil {
+		return rules, err
+	}
+	if cfg.Width > 0 {
+		rules.Board.Width = cfg.Width
+	}
+	if cfg.Height > 0 {
+		rules.Board.Height = cfg.Height
+	}
+	if err := rules.Validate(); err != nil {
+		return rules, err
+	}
+	if len(cfg.AIs) < 2 {
+		return rules, errors.New("a simulation needs at least 2 AI players")
+	}
+	if spawns := len(engine.SpawnPositions(rules.Board)); len(cfg.AIs) > spawns {
+		return rules, fmt.Errorf("the board only has %d spawns", spawns)
+	}
+	return rules, nil
+}
+
+func simulateRounds(cfg SimConfig, rules engine.GameRules, workers int) []simResult {
+	seeds := make(chan int64)
+	results := make([]simResult, cfg.LastSeed-cfg.FirstSeed+1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for seed := range seeds {
+				results[seed-cfg.FirstSeed] = simulateRound(cfg, rules, seed)
+			}
+		}()
+	}
+	for seed := cfg.FirstSeed; seed <= cfg.LastSeed; seed++ {
+		seeds <- seed
+	}
+	close(seeds)
+	wg.Wait()
+	return results
+}
+
+// simulateRound plays one round to the end as fast as it can be stepped.
+// The difficulties are rotated around the spawns by seed so that none of
+// them keeps the same corner.
+func simulateRound(cfg SimConfig, rules engine.GameRules, seed int64) simResult {
+	host := &simHost{}
+	game := engine.NewGame(fmt.Sprintf("sim-%d", seed), "simulate", seed, rules, host)
+
+	spawns := game.SpawnPositions()
+	difficulties := make(map[string]string)
+	for i := range cfg.AIs {
+		difficulty := cfg.AIs[(i+int(seed%int64(len(cfg.AIs)))+len(cfg.AIs))%len(cfg.AIs)]
+		id := fmt.Sprintf("ai-%d", i+1)
+		difficulties[id] = difficulty
+		game.AddPlayer(engine.Player{ID: id, Name: difficulty, IsAI: true, AIDifficulty: difficulty}, spawns[i])
+	}
+
+	for host.result == nil {
+		game.Step()
+	}
+	return simResult{state: host.result, stats: game.Stats(), difficulties: difficulties}
+}
+
+func buildSimReport(cfg SimConfig, results []simResult) *SimReport {
+	report := &SimReport{Config: cfg, Games: len(results)}
+
+	byDifficulty := make(map[string]*SimDifficultyStats)
+	for _, name := range cfg.AIs {
+		if byDifficulty[name] == nil {
+			byDifficulty[name] = &SimDifficultyStats{Difficulty: name}
+			report.Difficulties = append(report.Difficulties, byDifficulty[name])
+		}
+	}
+	for _, b := range pickupBuckets {
+		report.Pickups = append(report.Pickups, &SimPickupStats{Pickups: b.Label})
+	}
+
+	lengths := make([]float64, 0, len(results))
+	for _, r := range results {
+		if r.state.Winner == "" {
+			report.Draws++
+		}
+		lengths = append(lengths, r.state.EndTime.Sub(r.state.StartTime).Seconds())
+
+		for id, player := range r.state.Players {
+			won := r.state.Winner == id
+			s := r.stats[id]
+
+			d := byDifficulty[r.difficulties[id]]
+			d.Players++
+			if won {
+				d.Wins++
+			}
+			d.totalScore += player.Score
+			d.totalTiles += s.TilesDestroyed
+			d.totalKills += s.Kills
+			d.totalDeaths += s.Deaths
+			d.totalPickups += s.Pickups
+
+			p := report.Pickups[pickupBucket(s.Pickups)]
+			p.Players++
+			if won {
+				p.wins++
+			}
+			p.score += player.Score
+		}
+	}
+
+	for _, d := range report.Difficulties {
+		if d.Players == 0 {
+			continue
+		}
+		n := float64(d.Players)
+		d.WinRate = float64(d.Wins) / n
+		d.AvgScore = float64(d.totalScore) / n
+		d.AvgTiles = float64(d.totalTiles) / n
+		d.AvgKills = float64(d.totalKills) / n
+		d.AvgDeaths = float64(d.totalDeaths) / n
+		d.AvgPickups = float64(d.totalPickups) / n
+	}
+	for _, p := range report.Pickups {
+		if p.Players == 0 {
+			continue
+		}
+		p.WinRate = float64(p.wins) / float64(p.Players)
+		p.AvgScore = float64(p.score) / float64(p.Players)
+	}
+
+	if len(lengths) > 0 {
+		sort.Float64s(lengths)
+		total := 0.0
+		for _, l := range lengths {
+			total += l
+		}
+		report.MinLength = lengths[0]
+		report.AvgLength = total / float64(len(lengths))
+		report.MedianLength = lengths[len(lengths)/2]
+		report.P90Length = lengths[len(lengths)*9/10]
+		report.MaxLength = lengths[len(lengths)-1]
+
+		bucket := simLengthBucket.Seconds()
+		for _, l := range lengths {
+			i := max(int(math.Ceil(l/bucket))-1, 0)
+			for len(report.Lengths) <= i {
+				from := float64(len(report.Lengths)) * bucket
+				report.Lengths = append(report.Lengths, &SimLengthBucket{From: from, To: from + bucket})
+			}
+			report.Lengths[i].Games++
+		}
+	}
+	return report
+}
+
+func pickupBucket(pickups int) int {
+	for i, b := range pickupBuckets {
+		if b.Max < 0 || pickups <= b.Max {
+			return i
+		}
+	}
+	return len(pickupBuckets) - 1
+}
+
+func printSimReport(out io.Writer, r *SimReport) {
+	fmt.Fprintf(out, "%d games (seeds %d-%d), %s preset, %s, %.1fs\n\n",
+		r.Games, r.Config.FirstSeed, r.Config.LastSeed, r.Config.Preset, strings.Join(r.Config.AIs, " vs "), r.Elapsed)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "difficulty\tplayers\twin rate\tscore\ttiles\tkills\tdeaths\tpickups\t")
+	for _, d := range r.Difficulties {
+		fmt.Fprintf(w, "%s\t%d\t%.1f%%\t%.0f\t%.1f\t%.2f\t%.2f\t%.1f\t\n",
+			d.Difficulty, d.Players, d.WinRate*100, d.AvgScore, d.AvgTiles, d.AvgKills, d.AvgDeaths, d.AvgPickups)
+	}
+	fmt.Fprintf(w, "draws\t%d\t%.1f%%\t\t\t\t\t\t\n", r.Draws, float64(r.Draws)*100/float64(max(r.Games, 1)))
+	w.Flush()
+
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "pickups\tplayers\twin rate\tscore\t")
+	for _, p := range r.Pickups {
+		fmt.Fprintf(w, "%s\t%d\t%.1f%%\t%.0f\t\n", p.Pickups, p.Players, p.WinRate*100, p.AvgScore)
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\ngame length: min %.0fs, mean %.0fs, median %.0fs, p90 %.0fs, max %.0fs\n",
+		r.MinLength, r.AvgLength, r.MedianLength, r.P90Length, r.MaxLength)
+	for _, b := range r.Lengths {
+		bar := strings.Repeat("#", (b.Games*40+r.Games-1)/max(r.Games, 1))
+		fmt.Fprintf(out, "%4.0f-%4.0fs %6d %s\n", b.From, b.To, b.Games, bar)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSeedRange(t *testing.T) {
+	tests := []struct {
+		in          string
+		first, last int64
+		wantErr     bool
+	}{
+		{in: "1-1000", first: 1, last: 1000},
+		{in: "7", first: 7, last: 7},
+		{in: "5-3", wantErr: true},
+		{in: "a-3", wantErr: true},
+		{in: "1-", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			first, last, err := parseSeedRange(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %d-%d, want an error", first, last)
+				}
+				return
+			}
+			if err != nil || first != tt.first || last != tt.last {
+				t.Errorf("got %d-%d (%v), want %d-%d", first, last, err, tt.first, tt.last)
+			}
+		})
+	}
+}
+
+func TestSimulateIgnoresWorkerCount(t *testing.T) {
+	simulate := func(workers string) *SimReport {
+		t.Helper()
+		var out bytes.Buffer
+		args := []string{"-seeds", "1-3", "-ai", "easy,hard", "-workers", workers, "-json",
+			"-profiles", filepath.Join(t.TempDir(), "none.json")}
+		if err := runSimulate(args, &out); err != nil {
+			t.Fatal(err)
+		}
+		var report SimReport
+		if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		report.Elapsed = 0
+		return &report
+	}
+
+	one, three := simulate("1"), simulate("3")
+	if one.Games != 3 {
+		t.Errorf("played %d games, want 3", one.Games)
+	}
+	if !reflect.DeepEqual(one, three) {
+		t.Errorf("report depends on the worker count:\n%+v\n%+v", one, three)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"soulbomber-backend/engine"
+)
+
+// spectatorMessages are the only messages a spectator connection may send.
+var spectatorMessages = map[string]bool{
+	"spectate":           true,
+	"stopSpectating":     true,
+	"requestLobbyUpdate": true,
+	"ackState":           true,
+	"resync":             true,
+	"ping":               true,
+}
+
+// handleSpectate attaches the connection to a lobby as a spectator. It gets
+// the lobby's broadcasts like a player does but takes no slot and never
+// shows up in Players. The lobby's spectator delay is a floor; a spectator
+// may ask to be further behind, never closer.
+func (c *Connection) handleSpectate(payload interface{}) error {
+	data, ok := payload.(map[string]interface{})
+	if !ok {
+		return c.sendError("Invalid payload format")
+	}
+
+	lobbyID, ok := data["lobbyId"].(string)
+	if !ok {
+		return c.sendError("Missing lobbyId")
+	}
+	if err := ValidateUUID(lobbyID); err != nil {
+		return c.sendError("Invalid lobby ID")
+	}
+	if c.LobbyID != "" && !c.Spectator {
+		return c.sendError("Leave the lobby before spectating")
+	}
+
+	lobby, _, exists := getLobbyWithPlayers(lobbyID)
+	if !exists {
+		return c.sendError("lobby not found")
+	}
+
+	delay := lobby.Rules.SpectatorDelay
+	if seconds, ok := data["delay"].(float64); ok {
+		requested := time.Duration(seconds * float64(time.Second))
+		if requested < 0 || requested > engine.MaxSpectatorDelay {
+			return c.sendError("Invalid spectator delay")
+		}
+		delay = max(delay, requested)
+	}
+
+	c.readDeltaOption(data)
+	c.mu.Lock()
+	c.Spectator = true
+	c.spectatorDelay = delay
+	c.lastStateTick = -1
+	c.mu.Unlock()
+
+	oldLobby := c.LobbyID
+	c.LobbyID = lobbyID
+	hub.setConnectionLobby(c, oldLobby)
+
+	logInfo("Spectator joined", "connectionID", c.ID, "lobbyID", lobbyID, "delay", delay.String())
+	c.sendMessage("spectating", map[string]interface{}{
+		"lobbyId": lobbyID,
+		"delay":   delay.Milliseconds(),
+	})
+	if game := getGameByLobbyID(lobbyID); game != nil && delay == 0 {
+		c.sendMessage("gameState", game.Snapshot())
+	}
+
+	if oldLobby != "" && oldLobby != lobbyID {
+		broadcastLobbyUpdate(oldLobby)
+	}
+	broadcastLobbyUpdate(lobbyID)
+	return nil
+}
+
+func (c *Connection) handleStopSpectating() error {
+	if !c.Spectator {
+		return c.sendError("Not spectating")
+	}
+
+	c.mu.Lock()
+	c.Spectator = false
+	c.spectatorDelay = 0
+	c.mu.Unlock()
+
+	oldLobby := c.LobbyID
+	c.LobbyID = ""
+	hub.setConnectionLobby(c, oldLobby)
+
+	broadcastLobbyUpdate(oldLobby)
+	return c.sendMessage("left", "Stopped spectating")
+}
+
+func (c *Connection) spectating() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Spectator
+}
+
+func (c *Connection) delay() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.spectatorDelay
+}
+
+// delayedFrame is one broadcast held back for the spectators of a lobby
+// who share a delay.
+type delayedFrame struct {
+	due     time.Time
+	conns   []*Connection
+	deliver func(*Connection)
+}
+
+// delayQueue sends a lobby's frames for one delay in the order they were
+// broadcast. A single goroutine drains it while it has frames.
+type delayQueue struct {
+	frames  []delayedFrame
+	running bool
+}
+
+type delayKey struct {
+	lobbyID string
+	delay   time.Duration
+}
+
+var (
+	delayQueues   = make(map[delayKey]*delayQueue)
+	delayQueuesMu sync.Mutex
+)
+
+// deliverDelayed calls deliver for each connection once its delay has
+// passed. Frames for the same lobby and delay go out in broadcast order.
+// Connections that have gone away in the meantime are skipped.
+func deliverDelayed(lobbyID string, conns []*Connection, deliver func(*Connection)) {
+	byDelay := make(map[time.Duration][]*Connection)
+	for _, conn := range conns {
+		d := conn.delay()
+		byDelay[d] = append(byDelay[d], conn)
+	}
+
+	now := time.Now()
+	delayQueuesMu.Lock()
+	defer delayQueuesMu.Unlock()
+	for d, group := range byDelay {
+		key := delayKey{lobbyID: lobbyID, delay: d}
+		q, ok := delayQueues[key]
+		if !ok {
+			q = &delayQueue{}
+			delayQueues[key] = q
+		}
+		q.frames = append(q.frames, delayedFrame{due: now.Add(d), conns: group, deliver: deliver})
+		if !q.running {
+			q.running = true
+			go q.run(key)
+		}
+	}
+}
+
+func (q *delayQueue) run(key delayKey) {
+	for {
+		delayQueuesMu.Lock()
+		if len(q.frames) == 0 {
+			q.running = false
+			delete(delayQueues, key)
+			delayQueuesMu.Unlock()
+			return
+		}
+		frame := q.frames[0]
+		q.frames = q.frames[1:]
+		delayQueuesMu.Unlock()
+
+		time.Sleep(time.Until(frame.due))
+
+		hub.mu.RLock()
+		for _, conn := range frame.conns {
+			if hub.connections[conn.ID] == conn {
+				frame.deliver(conn)
+			}
+		}
+		hub.mu.RUnlock()
+	}
+}
+
+// spectatorCounts reports how many spectators are watching each lobby.
+func (h *Hub) spectatorCounts() map[string]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for lobbyID, conns := range h.lobbyConnections {
+		for _, conn := range conns {
+			if conn.spectating() {
+				counts[lobbyID]++
+			}
+		}
+	}
+	return counts
+}
+
+func (h *Hub) spectatorCount(lobbyID string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	count := 0
+	for _, conn := range h.lobbyConnections[lobbyID] {
+		if conn.spectating() {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeliverDelayedKeepsBroadcastOrder(t *testing.T) {
+	conn := testLobbyConn(t, "lobby")
+	conn.spectatorDelay = 20 * time.Millisecond
+	hub.connections[conn.ID] = conn
+	// The queue goroutine reads hub until it drains, so let it finish
+	// before the next test replaces hub.
+	t.Cleanup(func() {
+		for {
+			delayQueuesMu.Lock()
+			_, running := delayQueues[delayKey{lobbyID: "lobby", delay: conn.spectatorDelay}]
+			delayQueuesMu.Unlock()
+			if !running {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	var (
+		mu   sync.Mutex
+		got  []string
+		done = make(chan struct{})
+	)
+	const frames = 50
+	for i := 0; i < frames; i++ {
+		frame := fmt.Sprint(i)
+		deliverDelayed("lobby", []*Connection{conn}, func(*Connection) {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, frame)
+			if len(got) == frames {
+				close(done)
+			}
+		})
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("delayed frames were not delivered")
+	}
+	want := make([]string, frames)
+	for i := range want {
+		want[i] = fmt.Sprint(i)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("frames delivered in order %v", got)
+	}
+}
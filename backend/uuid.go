@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"time"
@@ -23,3 +24,21 @@ func newUUID() string {
 		hex.EncodeToString(b[10:16]),
 	)
 }
+
+func newSeed() int64 {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.LittleEndian.Uint64(b) >> 1)
+}
+
+// newToken returns a random secret for clients to present later.
+func newToken() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return newUUID()
+	}
+	return hex.EncodeToString(b)
+}
@@ -4,13 +4,15 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"soulbomber-backend/engine"
 )
 
 var (
 	uuidRegex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
 	nameRegex = regexp.MustCompile(`^[a-zA-Z0-9\s\-_]{1,20}$`)
+	mapIDRegex = regexp.MustCompile(`^[a-zA-Z0-9\-_]{1,64}$`)
 	directions = []string{"up", "down", "left", "right"}
-	difficulties = []string{AI_EASY, AI_MEDIUM, AI_HARD, AI_CHOSEN_ONE}
 )
 
 func ValidateLobbyName(name string) error {
@@ -55,14 +57,50 @@ func ValidateDirection(direction string) error {
 }
 
 func ValidateDifficulty(difficulty string) error {
-	for _, validDiff := range difficulties {
-		if difficulty == validDiff {
-			return nil
-		}
+	if _, ok := engine.LookupAIProfile(difficulty); ok {
+		return nil
 	}
 	return fmt.Errorf("invalid difficulty: %s", difficulty)
 }
 
+func ParseReplaySpeed(speed string) (float64, error) {
+	switch speed {
+	case "", "1", "1x":
+		return 1, nil
+	case "0.5", "0.5x":
+		return 0.5, nil
+	case "2", "2x":
+		return 2, nil
+	}
+	return 0, fmt.Errorf("invalid replay speed: %s", speed)
+}
+
+func ValidateTeam(team, teams int) error {
+	if teams == 0 {
+		return fmt.Errorf("lobby does not use teams")
+	}
+	if team < 1 || team > teams {
+		return fmt.Errorf("team must be between 1 and %d", teams)
+	}
+	return nil
+}
+
+func ValidateMapID(id string) error {
+	if !mapIDRegex.MatchString(id) {
+		return fmt.Errorf("invalid map ID")
+	}
+	return nil
+}
+
+// ValidateBotID accepts the UUIDs of registered bots and the IDs of local
+// bots.
+func ValidateBotID(id string) error {
+	if !uuidRegex.MatchString(id) && !(strings.HasPrefix(id, localBotPrefix) && localBotNameRegex.MatchString(strings.TrimPrefix(id, localBotPrefix))) {
+		return fmt.Errorf("invalid bot ID")
+	}
+	return nil
+}
+
 func ValidateUUID(id string) error {
 	if !uuidRegex.MatchString(id) {
 		return fmt.Errorf("invalid UUID format")
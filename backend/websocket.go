@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,6 +10,8 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"soulbomber-backend/engine"
 )
 
 const (
@@ -19,13 +22,33 @@ const (
 )
 
 type Connection struct {
-	ID       string
-	Conn     *websocket.Conn
-	PlayerID string
-	LobbyID  string
-	Send     chan []byte
-	Hub      *Hub
-	mu       sync.Mutex
+	ID         string
+	Conn       *websocket.Conn
+	PlayerID   string
+	LobbyID    string
+	Format     string
+	WantsDelta bool
+	Spectator  bool
+	// Replay connections only watch a recorded match and may not send
+	// anything that acts on a live game.
+	Replay        bool
+	Send          chan []byte
+	Hub           *Hub
+	closed        chan struct{}
+	mu            sync.Mutex
+	lastStateTick int64
+	ackTick       int64
+	keyframeTick  int64
+	// spectatorDelay holds back everything sent to a spectator by this
+	// much, so they can't relay the live game to a player.
+	spectatorDelay time.Duration
+	// Bot is set once the connection has authenticated as a bot. The
+	// fields after it track the observation the bot has to answer.
+	Bot         *BotIdentity
+	botGame     string
+	botTick     int64
+	botDeadline time.Time
+	botPending  bool
 }
 
 type Hub struct {
@@ -116,12 +139,37 @@ func (h *Hub) setConnectionLobby(conn *Connection, oldLobby string) {
 	h.lobbyConnections[conn.LobbyID][conn.ID] = conn
 }
 
+// sendToConnection delivers a message to conn only while it is still
+// registered, so callers outside the connection's own goroutines never
+// write to a closed Send channel.
+func (h *Hub) sendToConnection(conn *Connection, messageType string, payload interface{}) {
+	data, err := encodeMessage(conn.Format, messageType, payload)
+	if err != nil {
+		logError("Failed to marshal message", err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.connections[conn.ID] != conn {
+		return
+	}
+	select {
+	case conn.Send <- data:
+	default:
+	}
+}
+
 func (c *Connection) readPump() {
 	defer func() {
+		close(c.closed)
 		c.Hub.unregister <- c
 		c.Conn.Close()
-		if c.PlayerID != "" {
+		if c.PlayerID != "" && !holdSeat(c) {
 			playerTracker.UnregisterPlayer(c.PlayerID, c.ID)
+			if playerTracker.GetPlayerSession(c.PlayerID) == nil {
+				revokeSeats(c.PlayerID)
+			}
 			if c.LobbyID != "" {
 				leaveLobby(c.LobbyID, c.PlayerID)
 			}
@@ -139,7 +187,7 @@ func (c *Connection) readPump() {
 	})
 
 	for {
-		_, message, err := c.Conn.ReadMessage()
+		messageType, message, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				logError("WebSocket read error", err,
@@ -149,6 +197,19 @@ func (c *Connection) readPump() {
 			}
 			break
 		}
+		if messageType == websocket.BinaryMessage {
+			msg, err := decodeBinaryInput(message)
+			if err == nil {
+				err = c.dispatchMessage(msg)
+			}
+			if err != nil {
+				logError("Failed to handle binary message", err,
+					"connectionID", c.ID,
+					"playerID", c.PlayerID,
+				)
+			}
+			continue
+		}
 		if err := c.handleMessage(message); err != nil {
 			logError("Failed to handle message", err,
 				"connectionID", c.ID,
@@ -175,7 +236,11 @@ func (c *Connection) writePump() {
 				return
 			}
 
-			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			frameType := websocket.TextMessage
+			if isBinaryFrame(message) {
+				frameType = websocket.BinaryMessage
+			}
+			if err := c.Conn.WriteMessage(frameType, message); err != nil {
 				return
 			}
 
@@ -193,12 +258,31 @@ func (c *Connection) handleMessage(message []byte) error {
 	if err := json.Unmarshal(message, &msg); err != nil {
 		return err
 	}
+	return c.dispatchMessage(msg)
+}
 
+func (c *Connection) dispatchMessage(msg Message) error {
 	logWebSocketEvent(msg.Type, c.PlayerID, msg.Payload)
 
+	if c.Spectator && !spectatorMessages[msg.Type] {
+		return c.sendError("Spectators cannot send " + msg.Type)
+	}
+	if c.Replay && !replayMessages[msg.Type] {
+		return c.sendError("Replay viewers cannot send " + msg.Type)
+	}
+	if c.bot() != nil && !botMessages[msg.Type] {
+		return c.sendError("Bots cannot send " + msg.Type)
+	}
+
 	switch msg.Type {
 	case "joinLobby":
 		return c.handleJoinLobby(msg.Payload)
+	case "reconnect":
+		return c.handleReconnect(msg.Payload)
+	case "botAuth":
+		return c.handleBotAuth(msg.Payload)
+	case "action":
+		return c.handleBotAction(msg.Payload)
 	case "joinGame":
 		return c.handleJoinGame(msg.Payload)
 	case "startGame":
@@ -219,10 +303,20 @@ func (c *Connection) handleMessage(message []byte) error {
 		return c.handleRestartGame(msg.Payload)
 	case "updatePlayerName":
 		return c.handleUpdatePlayerName(msg.Payload)
+	case "setTeam":
+		return c.handleSetTeam(msg.Payload)
+	case "spectate":
+		return c.handleSpectate(msg.Payload)
+	case "stopSpectating":
+		return c.handleStopSpectating()
 	case "requestLobbyUpdate":
 		return c.handleRequestLobbyUpdate(msg.Payload)
 	case "requestPlayerInfo":
 		return c.handleRequestPlayerInfo(msg.Payload)
+	case "ackState":
+		return c.handleAckState(msg.Payload)
+	case "resync":
+		return c.handleResync()
 	case "ping":
 		return c.handlePing()
 	default:
@@ -241,12 +335,19 @@ func (c *Connection) handleJoinLobby(payload interface{}) error {
 		return c.sendError("Missing lobbyId")
 	}
 
+	bot := c.bot()
 	playerID, ok := data["playerId"].(string)
+	if bot != nil {
+		playerID, ok = newUUID(), true
+	}
 	if !ok {
 		return c.sendError("Missing playerId")
 	}
 
 	playerName, _ := data["playerName"].(string)
+	if bot != nil {
+		playerName = bot.Name
+	}
 	if playerName == "" {
 		playerName = "Player"
 	}
@@ -257,6 +358,9 @@ func (c *Connection) handleJoinLobby(payload interface{}) error {
 	c.PlayerID = playerID
 
 	playerTracker.RegisterPlayer(playerID, lobbyID, playerName, c.ID, false)
+	if bot != nil {
+		playerTracker.SetPlayerBot(playerID, bot.ID)
+	}
 
 	err := joinLobby(lobbyID, playerID)
 	if err != nil {
@@ -267,6 +371,17 @@ func (c *Connection) handleJoinLobby(payload interface{}) error {
 		return c.sendError(err.Error())
 	}
 
+	assignTeam(lobbyID, playerID)
+	c.readDeltaOption(data)
+	if bot != nil {
+		c.sendMessage("botJoined", map[string]interface{}{
+			"playerId": playerID,
+			"lobbyId":  lobbyID,
+		})
+	} else {
+		c.issueReconnectToken(lobbyID, playerID, playerName)
+	}
+
 	oldLobby := c.LobbyID
 	c.LobbyID = lobbyID
 	hub.setConnectionLobby(c, oldLobby)
@@ -286,14 +401,56 @@ func (c *Connection) handleJoinGame(payload interface{}) error {
 		return c.sendError("Missing lobbyId")
 	}
 
+	c.readDeltaOption(data)
+
 	game := getGameByLobbyID(lobbyID)
 	if game != nil {
-		return c.sendMessage("gameState", game)
+		c.mu.Lock()
+		c.lastStateTick = -1
+		c.mu.Unlock()
+		return c.sendMessage("gameState", game.Snapshot())
 	} else {
 		return c.sendError("Game not found")
 	}
 }
 
+func (c *Connection) readDeltaOption(data map[string]interface{}) {
+	if wantsDelta, ok := data["delta"].(bool); ok {
+		c.mu.Lock()
+		c.WantsDelta = wantsDelta
+		c.lastStateTick = -1
+		c.mu.Unlock()
+	}
+}
+
+func (c *Connection) handleAckState(payload interface{}) error {
+	data, ok := payload.(map[string]interface{})
+	if !ok {
+		return c.sendError("Invalid payload format")
+	}
+
+	tick, ok := data["tick"].(float64)
+	if !ok {
+		return c.sendError("Missing tick")
+	}
+
+	// Only a tick this connection was sent since its last keyframe can be a
+	// delta base; anything else is stale, possibly from an earlier game.
+	c.mu.Lock()
+	if t := int64(tick); t > c.ackTick && t >= c.keyframeTick && t <= c.lastStateTick {
+		c.ackTick = t
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Connection) handleResync() error {
+	c.mu.Lock()
+	c.lastStateTick = -1
+	c.mu.Unlock()
+	return nil
+}
+
 func (c *Connection) handleStartGame(payload interface{}) error {
 	data, ok := payload.(map[string]interface{})
 	if !ok {
@@ -311,7 +468,7 @@ func (c *Connection) handleStartGame(payload interface{}) error {
 	}
 
 	gamesMu.RLock()
-	var existingGame *Game
+	var existingGame *engine.Game
 	for _, game := range games {
 		if game.LobbyID == lobbyID {
 			existingGame = game
@@ -321,7 +478,7 @@ func (c *Connection) handleStartGame(payload interface{}) error {
 	gamesMu.RUnlock()
 
 	if existingGame != nil {
-		broadcastToLobby(lobbyID, "gameState", existingGame)
+		broadcastToLobby(lobbyID, "gameState", existingGame.Snapshot())
 		return nil
 	}
 
@@ -329,7 +486,7 @@ func (c *Connection) handleStartGame(payload interface{}) error {
 	if err != nil {
 		return c.sendError(err.Error())
 	}
-	broadcastToLobby(lobbyID, "gameState", game)
+	broadcastToLobby(lobbyID, "gameState", game.Snapshot())
 	return nil
 }
 
@@ -349,7 +506,7 @@ func (c *Connection) handleStartSinglePlayer(payload interface{}) error {
 		return c.sendError("Missing playerId")
 	}
 	gamesMu.RLock()
-	var existingGame *Game
+	var existingGame *engine.Game
 	for _, game := range games {
 		if game.LobbyID == lobbyID {
 			existingGame = game
@@ -359,14 +516,14 @@ func (c *Connection) handleStartSinglePlayer(payload interface{}) error {
 	gamesMu.RUnlock()
 
 	if existingGame != nil {
-		c.sendMessage("gameState", existingGame)
+		c.sendMessage("gameState", existingGame.Snapshot())
 		return nil
 	}
 	game, err := startSinglePlayerGame(lobbyID, playerID)
 	if err != nil {
 		return c.sendError(err.Error())
 	}
-	broadcastToLobby(lobbyID, "gameState", game)
+	broadcastToLobby(lobbyID, "gameState", game.Snapshot())
 	return nil
 }
 
@@ -388,6 +545,7 @@ func (c *Connection) handleLeaveLobby(payload interface{}) error {
 
 	leaveLobby(lobbyID, playerID)
 	playerTracker.UnregisterPlayer(playerID, c.ID)
+	revokeSeats(playerID)
 
 	oldLobby := c.LobbyID
 	c.LobbyID = ""
@@ -413,10 +571,7 @@ func (c *Connection) handleMove(payload interface{}) error {
 
 	game := getGameByPlayerID(c.PlayerID)
 	if game != nil {
-		if err := game.movePlayer(c.PlayerID, direction); err != nil {
-			return c.sendError(err.Error())
-		}
-		broadcastToLobby(game.LobbyID, "gameState", game)
+		game.Enqueue(engine.Input{Type: engine.INPUT_MOVE, PlayerID: c.PlayerID, Direction: direction})
 		return nil
 	}
 
@@ -426,10 +581,7 @@ func (c *Connection) handleMove(payload interface{}) error {
 func (c *Connection) handlePlaceBomb(_ interface{}) error {
 	game := getGameByPlayerID(c.PlayerID)
 	if game != nil {
-		if err := game.placeBomb(c.PlayerID); err != nil {
-			return c.sendError(err.Error())
-		}
-		broadcastToLobby(game.LobbyID, "gameState", game)
+		game.Enqueue(engine.Input{Type: engine.INPUT_PLACE_BOMB, PlayerID: c.PlayerID})
 		return nil
 	}
 
@@ -442,11 +594,7 @@ func (c *Connection) handleRemoteDetonate(_ interface{}) error {
 		return c.sendError("Game not found")
 	}
 
-	if err := game.remoteDetonate(c.PlayerID); err != nil {
-		return c.sendError(err.Error())
-	}
-
-	broadcastToLobby(game.LobbyID, "gameState", game)
+	game.Enqueue(engine.Input{Type: engine.INPUT_REMOTE_DETONATE, PlayerID: c.PlayerID})
 	return nil
 }
 
@@ -459,17 +607,16 @@ func (c *Connection) handleDash(payload interface{}) error {
 	if !ok {
 		return c.sendError("Missing direction")
 	}
+	if err := ValidateDirection(direction); err != nil {
+		return c.sendError(err.Error())
+	}
 
 	game := getGameByPlayerID(c.PlayerID)
 	if game == nil {
 		return c.sendError("Game not found")
 	}
 
-	if err := game.dash(c.PlayerID, direction); err != nil {
-		return c.sendError(err.Error())
-	}
-
-	broadcastToLobby(game.LobbyID, "gameState", game)
+	game.Enqueue(engine.Input{Type: engine.INPUT_DASH, PlayerID: c.PlayerID, Direction: direction})
 	return nil
 }
 
@@ -488,19 +635,14 @@ func (c *Connection) handleRestartGame(payload interface{}) error {
 	if !ok {
 		return c.sendError("Missing playerId")
 	}
-	gamesMu.Lock()
-	for gameID, game := range games {
-		if game.LobbyID == lobbyID {
-			delete(games, gameID)
-			break
-		}
+	if existing := getGameByLobbyID(lobbyID); existing != nil {
+		cleanupGame(existing.ID)
 	}
-	gamesMu.Unlock()
 	game, err := startGame(lobbyID, playerID)
 	if err != nil {
 		return c.sendError(err.Error())
 	}
-	broadcastToLobby(lobbyID, "gameState", game)
+	broadcastToLobby(lobbyID, "gameState", game.Snapshot())
 	return nil
 }
 
@@ -531,6 +673,42 @@ func (c *Connection) handleUpdatePlayerName(payload interface{}) error {
 	return c.sendMessage("playerNameUpdated", "Player name updated successfully")
 }
 
+func (c *Connection) handleSetTeam(payload interface{}) error {
+	data, ok := payload.(map[string]interface{})
+	if !ok {
+		return c.sendError("Invalid payload format")
+	}
+
+	team, ok := data["team"].(float64)
+	if !ok {
+		return c.sendError("Missing team")
+	}
+
+	if c.PlayerID == "" || c.LobbyID == "" {
+		return c.sendError("Not in a lobby")
+	}
+
+	if getGameByLobbyID(c.LobbyID) != nil {
+		return c.sendError("Cannot change teams during a game")
+	}
+
+	rules, err := getLobbyRules(c.LobbyID)
+	if err != nil {
+		logError("Failed to change team", err, "lobbyID", c.LobbyID)
+		return c.sendError("Lobby rules are unavailable")
+	}
+	if err := ValidateTeam(int(team), rules.Teams); err != nil {
+		return c.sendError(err.Error())
+	}
+
+	if playerTracker != nil {
+		playerTracker.SetPlayerTeam(c.PlayerID, int(team))
+	}
+
+	broadcastLobbyUpdate(c.LobbyID)
+	return nil
+}
+
 func (c *Connection) handleRequestLobbyUpdate(payload interface{}) error {
 	data, ok := payload.(map[string]interface{})
 	if !ok {
@@ -581,12 +759,7 @@ func (c *Connection) handlePing() error {
 }
 
 func (c *Connection) sendMessage(msgType string, payload interface{}) error {
-	message := Message{
-		Type:    msgType,
-		Payload: payload,
-	}
-
-	data, err := json.Marshal(message)
+	data, err := encodeMessage(c.Format, msgType, payload)
 	if err != nil {
 		return err
 	}
@@ -598,7 +771,7 @@ func (c *Connection) sendMessage(msgType string, payload interface{}) error {
 	case c.Send <- data:
 		return nil
 	default:
-		return c.sendError("Connection buffer full")
+		return errors.New("connection buffer full")
 	}
 }
 
@@ -607,16 +780,7 @@ func (c *Connection) sendError(message string) error {
 }
 
 func broadcastToLobby(lobbyID string, messageType string, payload interface{}) {
-	message := Message{
-		Type:    messageType,
-		Payload: payload,
-	}
-
-	data, err := json.Marshal(message)
-	if err != nil {
-		logError("Failed to marshal broadcast message", err)
-		return
-	}
+	encoded := make(map[string][]byte)
 
 	hub.mu.RLock()
 	m, ok := hub.lobbyConnections[lobbyID]
@@ -626,7 +790,24 @@ func broadcastToLobby(lobbyID string, messageType string, payload interface{}) {
 	}
 
 	count := 0
+	var delayed []*Connection
 	for _, conn := range m {
+		data, ok := encoded[conn.Format]
+		if !ok {
+			var err error
+			data, err = encodeMessage(conn.Format, messageType, payload)
+			if err != nil {
+				logError("Failed to marshal broadcast message", err)
+			}
+			encoded[conn.Format] = data
+		}
+		if data == nil {
+			continue
+		}
+		if conn.delay() > 0 {
+			delayed = append(delayed, conn)
+			continue
+		}
 		select {
 		case conn.Send <- data:
 			count++
@@ -634,6 +815,30 @@ func broadcastToLobby(lobbyID string, messageType string, payload interface{}) {
 		}
 	}
 	hub.mu.RUnlock()
+
+	if len(delayed) > 0 {
+		deliverDelayed(lobbyID, delayed, func(conn *Connection) {
+			select {
+			case conn.Send <- encoded[conn.Format]:
+			default:
+			}
+		})
+	}
+}
+
+func sendToPlayer(playerID string, messageType string, payload interface{}) {
+	hub.mu.RLock()
+	var targets []*Connection
+	for _, conn := range hub.connections {
+		if conn.PlayerID == playerID {
+			targets = append(targets, conn)
+		}
+	}
+	hub.mu.RUnlock()
+
+	for _, conn := range targets {
+		hub.sendToConnection(conn, messageType, payload)
+	}
 }
 
 func broadcastLobbyUpdate(lobbyID string) {
@@ -643,7 +848,7 @@ func broadcastLobbyUpdate(lobbyID string) {
 		return
 	}
 
-	playersMap := make(map[string]*Player)
+	playersMap := make(map[string]*engine.Player)
 	for i, player := range players {
 		playerCopy := player
 		playerCopy.Slot = i
@@ -662,24 +867,43 @@ func broadcastLobbyUpdate(lobbyID string) {
 var hub *Hub
 
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("mode") == "replay" {
+		handleReplayWebSocket(w, r)
+		return
+	}
+
+	upgradeConnection(w, r)
+}
+
+func upgradeConnection(w http.ResponseWriter, r *http.Request) *Connection {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logError("WebSocket upgrade failed", err)
-		return
+		return nil
 	}
 
 	if err := conn.SetCompressionLevel(2); err != nil {
 	}
 
+	format := formatJSON
+	if conn.Subprotocol() == binarySubprotocol || r.URL.Query().Get("format") == formatBinary {
+		format = formatBinary
+	}
+
 	connection := &Connection{
-		ID:   conn.RemoteAddr().String(),
-		Conn: conn,
-		Hub:  hub,
-		Send: make(chan []byte, 256),
+		ID:     conn.RemoteAddr().String(),
+		Conn:   conn,
+		Format: format,
+		Replay: r.URL.Query().Get("mode") == "replay",
+		Hub:    hub,
+		Send:   make(chan []byte, 256),
+		closed: make(chan struct{}),
 	}
 
 	connection.Hub.register <- connection
 
 	go connection.writePump()
 	go connection.readPump()
+
+	return connection
 }